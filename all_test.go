@@ -1,20 +1,36 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/fs"
 	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"thecoolthings/closer"
+	"thecoolthings/constants"
 	"thecoolthings/goroutines"
 	"thecoolthings/lookup"
 	"thecoolthings/slice_tricks"
 	"thecoolthings/sorter"
 	"thecoolthings/stringer"
 	"thecoolthings/structs"
+	"time"
 	"unsafe"
 )
 
@@ -127,6 +143,136 @@ func TestLookupMaps(t *testing.T) {
 	}
 }
 
+func TestLookupBitset(t *testing.T) {
+	myLookup, cheat := lookup.LookupBitsetSetup()
+	assert.True(t, myLookup.Test(cheat))
+	assert.False(t, myLookup.Test(14))
+	assert.False(t, myLookup.Test(-1))
+
+	items := func(b *lookup.Bitset) []int {
+		var items []int
+		b.Each(func(i int) bool {
+			items = append(items, i)
+			return true
+		})
+		return items
+	}
+
+	var a, b lookup.Bitset
+	for _, i := range []int{1, 5, 64, 200} {
+		a.Set(i)
+	}
+	b.Set(5)
+	b.Set(63)
+	b.Set(64)
+	assert.Equal(t, 4, a.Count())
+	assert.Equal(t, []int{1, 5, 64, 200}, items(&a))
+	assert.Equal(t, []int{1, 5, 63, 64, 200}, items(a.Union(&b)))
+	assert.Equal(t, []int{5, 64}, items(a.Intersect(&b)))
+	assert.Equal(t, []int{1, 200}, items(a.Difference(&b)))
+	assert.Equal(t, []int{63}, items(b.Difference(&a)))
+
+	// Each stops when asked
+	var first []int
+	a.Each(func(i int) bool {
+		first = append(first, i)
+		return len(first) < 2
+	})
+	assert.Equal(t, []int{1, 5}, first)
+
+	a.Clear(200)
+	a.Clear(1000) // never set, nothing to do
+	assert.False(t, a.Test(200))
+	assert.Panics(t, func() { a.Set(-1) })
+
+	// Trailing empty words aren't encoded
+	data, err := a.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Len(t, data, 16)
+	var decoded lookup.Bitset
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, items(&a), items(&decoded))
+	assert.ErrorIs(t, decoded.UnmarshalBinary([]byte{1, 2, 3}), lookup.ErrBitsetLength)
+
+	// Growing again after a trim
+	d := b.Difference(&b)
+	d.Set(70)
+	assert.Equal(t, []int{70}, items(d))
+}
+
+func TestLookupMeasureHeap(t *testing.T) {
+	const n = 10000
+	size := func(name string) uint64 {
+		for _, s := range lookup.Structures {
+			if s.Name == name {
+				return lookup.MeasureHeap(n, 5, s.Build)
+			}
+		}
+		t.Fatal("unknown structure", name)
+		return 0
+	}
+	bools, structSet, sorted, bitset := size("map[int]bool"), size("map[int]struct{}"), size("sorted []int"), size("bitset")
+	log.Println("map[int]bool", bools, "map[int]struct{}", structSet, "sorted []int", sorted, "bitset", bitset)
+
+	// 8 bytes per element is a floor for both maps, and they're well above it. Depending on
+	// the Go version, the bool may not even cost anything more : slots are padded.
+	assert.Greater(t, structSet, uint64(8*n))
+	assert.LessOrEqual(t, structSet, bools)
+	// The slice is its content rounded up to an allocation size, a bitset is 1 bit per element
+	assert.InEpsilon(t, 8*n, sorted, 0.05)
+	assert.InDelta(t, n/8, bitset, 128)
+
+	log.Printf("Heap bytes :\n%s", lookup.Footprints(lookup.Structures, []int{10, 1000, 100000}, 3))
+}
+
+func TestLookupSet(t *testing.T) {
+	a := lookup.NewSet(1, 2, 3, 3)
+	b := lookup.NewSet(3, 4)
+	assert.Equal(t, 3, a.Len())
+	assert.True(t, a.Has(2))
+	assert.False(t, a.Has(4))
+
+	assert.Equal(t, []int{1, 2, 3, 4}, lookup.Sorted(a.Union(b)))
+	assert.Equal(t, []int{3}, lookup.Sorted(a.Intersect(b)))
+	assert.Equal(t, []int{1, 2}, lookup.Sorted(a.Difference(b)))
+	assert.Equal(t, []int{1, 2, 4}, lookup.Sorted(a.SymmetricDifference(b)))
+	// Operations return new sets
+	assert.Equal(t, 3, a.Len())
+
+	assert.True(t, lookup.NewSet(1, 3).IsSubset(a))
+	assert.False(t, b.IsSubset(a))
+	assert.True(t, lookup.NewSet[int]().IsSubset(a))
+	assert.True(t, a.Equal(lookup.NewSet(3, 2, 1)))
+	assert.False(t, a.Equal(b))
+
+	a.Add(5)
+	a.Remove(1, 2)
+	assert.Equal(t, []int{3, 5}, lookup.Sorted(a))
+
+	// A nil set can be read, like a map
+	var empty lookup.Set[string]
+	assert.False(t, empty.Has("a"))
+	assert.Equal(t, 0, empty.Len())
+	assert.True(t, empty.Equal(lookup.NewSet[string]()))
+
+	// JSON : an array, always in the same order
+	data, err := json.Marshal(lookup.NewSet("b", "c", "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, `["a","b","c"]`, string(data))
+	// Numbers by value, not by encoding
+	data, err = json.Marshal(lookup.NewSet(2, 10, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, `[-1,2,10]`, string(data))
+	// Other types by encoding
+	data, err = json.Marshal(lookup.NewSet([2]int{1, 2}, [2]int{0, 3}))
+	assert.NoError(t, err)
+	assert.Equal(t, `[[0,3],[1,2]]`, string(data))
+	var decoded lookup.Set[string]
+	assert.NoError(t, json.Unmarshal([]byte(`["x","y","x"]`), &decoded))
+	assert.Equal(t, []string{"x", "y"}, lookup.Sorted(decoded))
+	assert.Error(t, json.Unmarshal([]byte(`[1]`), &decoded))
+}
+
 func TestFilterEvenNumbers(t *testing.T) {
 	type sliceDesc struct {
 		s      []int
@@ -195,7 +341,7 @@ func TestBatchWithoutAllocating(t *testing.T) {
 	assert.Equal(t, exp, b)
 }
 
-//Red 24, Yellow 25, Red 14, Yellow 12, Blue 16
+// Red 24, Yellow 25, Red 14, Yellow 12, Blue 16
 func TestPerfectStreet(t *testing.T) {
 	initial := []sorter.ColoredHouse{
 		{sorter.Red, 24},
@@ -217,6 +363,557 @@ func TestPerfectStreet(t *testing.T) {
 	assert.Equal(t, expected, initial)
 }
 
+// Same street, but "<=" on ages makes two identical houses less than each other.
+type sloppyStreet []sorter.ColoredHouse
+
+func (p sloppyStreet) Len() int      { return len(p) }
+func (p sloppyStreet) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p sloppyStreet) Less(i, j int) bool {
+	if p[i].Color != p[j].Color {
+		return p[i].Color < p[j].Color
+	}
+	return p[i].InhabitantAge <= p[j].InhabitantAge
+}
+
+// Like dataSortedByIdContact in sorter, an implementation left for later.
+type unfinishedStreet []sorter.ColoredHouse
+
+func (p unfinishedStreet) Len() int           { return len(p) }
+func (p unfinishedStreet) Less(i, j int) bool { panic("implement me") }
+func (p unfinishedStreet) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// Swap does nothing.
+type stuckSwap struct{ sort.IntSlice }
+
+func (stuckSwap) Swap(i, j int) {}
+
+// 0 is rock, 1 is paper, 2 is scissors : each one is less than the one beating it.
+type rockPaperScissors struct{ sort.IntSlice }
+
+func (p rockPaperScissors) Less(i, j int) bool { return (p.IntSlice[j]-p.IntSlice[i]+3)%3 == 1 }
+
+// Every element is less than every other one.
+type alwaysLess struct{ sort.IntSlice }
+
+func (alwaysLess) Less(i, j int) bool { return i != j }
+
+// Values closer than 1.5 are equal, so 0 = 1 and 1 = 2, but 0 < 2.
+type roughlyEqual struct{ sort.Float64Slice }
+
+func (p roughlyEqual) Less(i, j int) bool { return p.Float64Slice[j]-p.Float64Slice[i] > 1.5 }
+
+func TestCheckInterface(t *testing.T) {
+	street := []sorter.ColoredHouse{
+		{Color: sorter.Red, InhabitantAge: 24},
+		{Color: sorter.Yellow, InhabitantAge: 25},
+		{Color: sorter.Red, InhabitantAge: 14},
+		{Color: sorter.Yellow, InhabitantAge: 12},
+		{Color: sorter.Red, InhabitantAge: 24},
+	}
+	assert.NoError(t, sorter.CheckInterface(sorter.PerfectStreet(street)))
+
+	err := sorter.CheckInterface(sloppyStreet(street))
+	if assert.Error(t, err) {
+		log.Println(err)
+		assert.Equal(t, &sorter.ContractError{Property: "irreflexivity", Indexes: []int{0}}, err)
+	}
+
+	// Swap must not have been left half-done
+	assert.Equal(t, sorter.Red, street[0].Color)
+	assert.Equal(t, 24, street[0].InhabitantAge)
+
+	// An unfinished implementation fails the test instead of crashing it
+	err = sorter.CheckInterface(unfinishedStreet(street))
+	if assert.Error(t, err) {
+		log.Println(err)
+		assert.Equal(t, &sorter.ContractError{Property: "panic in Less", Indexes: []int{0, 0}, Panic: "implement me"}, err)
+	}
+
+	for _, c := range []struct {
+		data sort.Interface
+		want *sorter.ContractError
+	}{
+		{alwaysLess{sort.IntSlice{1, 2}}, &sorter.ContractError{Property: "asymmetry", Indexes: []int{0, 1}}},
+		{stuckSwap{sort.IntSlice{1, 2}}, &sorter.ContractError{Property: "swap", Indexes: []int{0, 1}}},
+		{rockPaperScissors{sort.IntSlice{0, 1, 2}}, &sorter.ContractError{Property: "transitivity", Indexes: []int{0, 1, 2}}},
+		{roughlyEqual{sort.Float64Slice{0, 1, 2}}, &sorter.ContractError{Property: "transitivity of equivalence", Indexes: []int{0, 1, 2}}},
+	} {
+		assert.Equal(t, c.want, sorter.CheckInterface(c.data), "%T", c.data)
+	}
+}
+
+func TestSortedList(t *testing.T) {
+	l := sorter.NewSortedList(func(a, b interface{}) bool { return a.(int) < b.(int) })
+	for _, v := range []int{50, 10, 40, 20, 30, 20} {
+		l.Insert(v)
+	}
+
+	var all []int
+	l.Each(func(v interface{}) bool {
+		all = append(all, v.(int))
+		return true
+	})
+	assert.Equal(t, []int{10, 20, 20, 30, 40, 50}, all)
+
+	assert.Equal(t, 30, l.At(3))
+	assert.Equal(t, 1, l.Rank(20))
+	assert.Equal(t, 3, l.Rank(25))
+
+	var between []int
+	l.Range(20, 40, func(v interface{}) bool {
+		between = append(between, v.(int))
+		return true
+	})
+	assert.Equal(t, []int{20, 20, 30}, between)
+
+	assert.True(t, l.Delete(20))
+	assert.False(t, l.Delete(25))
+	assert.Equal(t, 5, l.Len())
+	assert.Equal(t, 30, l.At(2))
+	assert.Panics(t, func() { l.At(5) })
+}
+
+func TestSortBySpec(t *testing.T) {
+	street := []sorter.ColoredHouse{
+		{Color: sorter.Red, InhabitantAge: 24},
+		{Color: sorter.Yellow, InhabitantAge: 25},
+		{Color: sorter.Red, InhabitantAge: 14},
+		{Color: sorter.Yellow, InhabitantAge: 12},
+		{Color: sorter.Blue, InhabitantAge: 16},
+	}
+	expected := []sorter.ColoredHouse{
+		{Color: sorter.Red, InhabitantAge: 24},
+		{Color: sorter.Red, InhabitantAge: 14},
+		{Color: sorter.Blue, InhabitantAge: 16},
+		{Color: sorter.Yellow, InhabitantAge: 25},
+		{Color: sorter.Yellow, InhabitantAge: 12},
+	}
+
+	assert.NoError(t, sorter.SortBy(street, "color:asc, age:desc"))
+	assert.Equal(t, expected, street)
+
+	assert.ErrorIs(t, sorter.SortBy(street, "owner"), sorter.ErrUnknownField)
+	assert.ErrorIs(t, sorter.SortBy(street, "color:up"), sorter.ErrInvalidSpec)
+	assert.ErrorIs(t, sorter.SortBy(street, "age,age:desc"), sorter.ErrInvalidSpec)
+
+	// Two fields with the same tag : neither silently wins
+	type ambiguous struct {
+		Created time.Time `sort:"date"`
+		Updated time.Time `sort:"date"`
+	}
+	err := sorter.SortBy([]ambiguous{{}, {}}, "date")
+	assert.ErrorIs(t, err, sorter.ErrInvalidSpec)
+	assert.EqualError(t, err, `invalid sort spec: Created and Updated both have the sort tag "date"`)
+
+	type visit struct {
+		At    time.Time `sort:"at"`
+		Notes []string  `sort:"notes"`
+	}
+	now := time.Now()
+	visits := []visit{{At: now}, {At: now.Add(-time.Hour)}}
+	assert.NoError(t, sorter.SortBy(visits, "at"))
+	assert.Equal(t, now.Add(-time.Hour), visits[0].At)
+	assert.ErrorIs(t, sorter.SortBy(visits, "notes"), sorter.ErrUnsortableField)
+}
+
+func TestStringOrderings(t *testing.T) {
+	files := []string{"item10", "item2", "item1", "item02", "item"}
+	sort.Sort(sorter.StringsBy(files, sorter.NaturalLess))
+	assert.Equal(t, []string{"item", "item1", "item02", "item2", "item10"}, files)
+
+	names := []string{"carol", "Bob", "alice"}
+	sort.Slice(names, func(i, j int) bool { return sorter.FoldLess(names[i], names[j]) })
+	assert.Equal(t, []string{"alice", "Bob", "carol"}, names)
+
+	contacts := []string{"Eric", "Zoe", "Émile", "eve"}
+	sort.Sort(sorter.StringsBy(contacts, sorter.AccentFoldLess))
+	assert.Equal(t, []string{"Émile", "Eric", "eve", "Zoe"}, contacts)
+}
+
+func BenchmarkStringLess(b *testing.B) {
+	names := []string{"Émile", "item10", "Zoe", "item2", "alice", "Eric", "contact 42", "contact 7"}
+	orderings := []struct {
+		name string
+		less func(a, b string) bool
+	}{
+		{"plain", func(a, b string) bool { return a < b }},
+		{"natural", sorter.NaturalLess},
+		{"fold", sorter.FoldLess},
+		{"accentFold", sorter.AccentFoldLess},
+	}
+
+	for _, o := range orderings {
+		b.Run(o.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, x := range names {
+					for _, y := range names {
+						tmpv = o.less(x, y)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	board := sorter.NewLeaderboard()
+	for id := uint64(1); id <= 10; id++ {
+		board.Increment(id, uint(id))
+	}
+	assert.Equal(t, 1, board.Rank(10))
+	assert.Equal(t, 10, board.Rank(1))
+	assert.Equal(t, 0, board.Rank(42))
+
+	// Contact 1 gets a lot of messages at once : no re-sort needed to know it's first now
+	assert.Equal(t, uint(21), board.Increment(1, 20))
+	assert.Equal(t, 1, board.Rank(1))
+	assert.Equal(t, 2, board.Rank(10))
+	assert.Equal(t, []sorter.LeaderboardEntry{
+		{IdContact: 9, MessageReceivedCount: 9},
+		{IdContact: 8, MessageReceivedCount: 8},
+	}, board.Top(2, 2))
+	// The limit is clamped without overflowing
+	assert.Equal(t, []sorter.LeaderboardEntry{{IdContact: 2, MessageReceivedCount: 2}}, board.Top(9, math.MaxInt))
+	assert.Empty(t, board.Top(10, 1))
+	assert.Empty(t, board.Top(0, 0))
+
+	p, ok := board.Percentile(1)
+	assert.True(t, ok)
+	assert.Equal(t, 90.0, p)
+	p, _ = board.Percentile(2)
+	assert.Equal(t, 0.0, p)
+
+	e, ok := board.AtPercentile(80)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), e.IdContact)
+
+	board.Remove(1)
+	assert.Equal(t, 9, board.Len())
+	assert.Equal(t, 1, board.Rank(10))
+}
+
+func TestTColorEnum(t *testing.T) {
+	assert.Equal(t, "Yellow", sorter.Yellow.String())
+	assert.Equal(t, "TColor(42)", fmt.Sprint(sorter.TColor(42)))
+	assert.Equal(t, []sorter.TColor{sorter.Red, sorter.Blue, sorter.Green, sorter.Yellow, sorter.Black}, sorter.Values())
+
+	c, err := sorter.ParseTColor("green")
+	assert.NoError(t, err)
+	assert.Equal(t, sorter.Green, c)
+	_, err = sorter.ParseTColor("Purple")
+	assert.Error(t, err)
+
+	house := sorter.ColoredHouse{Color: sorter.Blue, InhabitantAge: 16}
+	b, err := json.Marshal(house)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Color":"Blue","InhabitantAge":16}`, string(b))
+	var decoded sorter.ColoredHouse
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, house, decoded)
+	assert.Error(t, json.Unmarshal([]byte(`{"Color":"Purple"}`), &decoded))
+	_, err = json.Marshal(sorter.TColor(42))
+	assert.Error(t, err)
+
+	v, err := sorter.Black.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "Black", v)
+	assert.NoError(t, c.Scan([]byte("Red")))
+	assert.Equal(t, sorter.Red, c)
+	assert.NoError(t, c.Scan(int64(3)))
+	assert.Equal(t, sorter.Yellow, c)
+	assert.Error(t, c.Scan(int64(5)))
+	assert.Error(t, c.Scan(nil))
+}
+
+func TestLazy(t *testing.T) {
+	var calls int32
+	fail := true
+	lazy := constants.NewLazy(func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		if fail {
+			return nil, errors.New("endpoint down")
+		}
+		return 42, nil
+	})
+
+	// Concurrent first uses only run the initializer once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := lazy.Get()
+			assert.Error(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// NeverRetry : the error is cached
+	fail = false
+	_, err := lazy.Get()
+	assert.Error(t, err)
+
+	lazy.SetRetryPolicy(constants.AlwaysRetry, 0)
+	v, err := lazy.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+	assert.Equal(t, 42, lazy.MustGet())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	lazy.Override(7)
+	assert.Equal(t, 7, lazy.MustGet())
+	lazy.Reset()
+	assert.Equal(t, 42, lazy.MustGet())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	delayed := constants.NewLazy(func() (interface{}, error) { return nil, errors.New("nope") })
+	delayed.SetRetryPolicy(constants.RetryAfterDelay, 10*time.Millisecond)
+	_, err1 := delayed.Get()
+	_, err2 := delayed.Get()
+	assert.Same(t, err1, err2)
+	time.Sleep(20 * time.Millisecond)
+	_, err3 := delayed.Get()
+	assert.NotSame(t, err1, err3)
+}
+
+func TestFrozenMap(t *testing.T) {
+	literal := map[string]int{"b": 2, "a": 1, "c": 3}
+	frozen := constants.Freeze(literal)
+
+	// Changing the literal afterwards doesn't change the frozen map
+	literal["a"] = 100
+	v, ok := frozen.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.False(t, frozen.Has("d"))
+	assert.Equal(t, 3, frozen.Len())
+	assert.Equal(t, []string{"a", "b", "c"}, frozen.Keys())
+
+	var visited []string
+	frozen.Range(func(key string, val int) bool {
+		visited = append(visited, key)
+		return key != "b"
+	})
+	assert.Equal(t, []string{"a", "b"}, visited)
+
+	mutable := frozen.Copy()
+	mutable["a"] = 42
+	v, _ = frozen.Get("a")
+	assert.Equal(t, 1, v)
+
+	var empty constants.FrozenMap
+	assert.Equal(t, 0, empty.Len())
+	assert.False(t, empty.Has("a"))
+}
+
+func TestEmbeddedLoader(t *testing.T) {
+	loader := constants.NewLoader()
+	loader.OverrideDir = ""
+
+	retries, err := loader.Load("retries.csv", constants.Schema{Required: []string{"mail", "push", "sms"}, Min: constants.Bound(0), Max: constants.Bound(10)})
+	assert.NoError(t, err)
+	v, _ := retries.Get("push")
+	assert.Equal(t, 5, v)
+
+	simple, err := loader.Load("simple.json", constants.Schema{Required: []string{"This is a simple thing"}})
+	assert.NoError(t, err)
+	v, _ = simple.Get("This is a simple thing")
+	assert.Equal(t, 2, v)
+
+	_, err = loader.Load("retries.csv", constants.Schema{Min: constants.Bound(2), Max: constants.Bound(10)})
+	assert.EqualError(t, err, `retries.csv:4: value 1 for "sms" is below the minimum 2`)
+	// Each bound on its own, and 0 is a bound like any other
+	_, err = loader.Load("retries.csv", constants.Schema{Min: constants.Bound(1)})
+	assert.NoError(t, err)
+	_, err = loader.Load("retries.csv", constants.Schema{Max: constants.Bound(0)})
+	assert.EqualError(t, err, `retries.csv:2: value 3 for "mail" is above the maximum 0`)
+	_, err = loader.Load("retries.csv", constants.Schema{Required: []string{"fax"}})
+	assert.EqualError(t, err, `retries.csv: missing required key "fax"`)
+	_, err = loader.Load("missing.json", constants.Schema{})
+	assert.Error(t, err)
+
+	// Dev mode : files in the override directory win over the embedded ones
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "simple.json"), []byte("{\n\t\"This is a simple thing\": 3,\n\t\"broken\": \"x\"\n}"), 0o644))
+	loader.OverrideDir = dir
+	_, err = loader.Load("simple.json", constants.Schema{})
+	var loadErr *constants.LoadError
+	if assert.True(t, errors.As(err, &loadErr)) {
+		assert.Equal(t, filepath.Join(dir, "simple.json"), loadErr.File)
+		assert.Equal(t, 3, loadErr.Line)
+	}
+	retries, err = loader.Load("retries.csv", constants.Schema{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, retries.Len())
+}
+
+func TestReloadable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "limits.csv")
+	assert.NoError(t, os.WriteFile(file, []byte("mail,3\n"), 0o644))
+
+	schema := constants.Schema{Required: []string{"mail"}, Min: constants.Bound(0), Max: constants.Bound(10)}
+	limits, err := constants.NewReloadable(file, schema)
+	assert.NoError(t, err)
+	first := limits.Get()
+	v, _ := first.Values.Get("mail")
+	assert.Equal(t, 3, v)
+
+	updates, unsubscribe := limits.Subscribe()
+
+	// Same content : no new version
+	changed, err := limits.Reload()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// Invalid content : the error is reported, and the old snapshot is still served
+	assert.NoError(t, os.WriteFile(file, []byte("mail,300\n"), 0o644))
+	_, err = limits.Reload()
+	assert.EqualError(t, err, file+`:1: value 300 for "mail" is above the maximum 10`)
+	assert.Same(t, first, limits.Get())
+
+	// The watcher picks up the next valid version by itself
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var watchErrors int32
+	go limits.Watch(ctx, 5*time.Millisecond, func(error) { atomic.AddInt32(&watchErrors, 1) })
+	assert.NoError(t, os.WriteFile(file, []byte("mail,5\npush,1\n"), 0o644))
+
+	select {
+	case snap := <-updates:
+		assert.Equal(t, first.Version+1, snap.Version)
+		v, _ = snap.Values.Get("mail")
+		assert.Equal(t, 5, v)
+		assert.Same(t, snap, limits.Get())
+	case <-time.After(time.Second):
+		t.Fatal("no update received")
+	}
+
+	// A deleted file is reported once, not on every tick
+	assert.NoError(t, os.Remove(file))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&watchErrors) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&watchErrors))
+	assert.NoError(t, os.WriteFile(file, []byte("mail,7\n"), 0o644))
+	select {
+	case snap := <-updates:
+		v, _ = snap.Values.Get("mail")
+		assert.Equal(t, 7, v)
+	case <-time.After(time.Second):
+		t.Fatal("no update received")
+	}
+
+	unsubscribe()
+	_, open := <-updates
+	assert.False(t, open)
+}
+
+func TestRemoteLoader(t *testing.T) {
+	var requests int32
+	slow := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/slow" {
+			<-slow
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"Stuff from request Body": 42}`))
+	}))
+	defer server.Close()
+	defer close(slow)
+
+	ctx := context.Background()
+	var errs []error
+	remote := &constants.RemoteLoader{
+		URL:       server.URL,
+		Timeout:   10 * time.Second,
+		CacheFile: filepath.Join(t.TempDir(), "remote.json"),
+		Fallback:  "simple.json",
+		OnError:   func(err error) { errs = append(errs, err) },
+	}
+
+	values, source, err := remote.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.SourceRemote, source)
+	v, _ := values.Get("Stuff from request Body")
+	assert.Equal(t, 42, v)
+
+	// The ETag was cached, so the server only answers 304
+	values, source, err = remote.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.SourceNotModified, source)
+	v, _ = values.Get("Stuff from request Body")
+	assert.Equal(t, 42, v)
+	assert.Empty(t, errs)
+
+	// Too slow : the cached copy is used, and the timeout reported
+	remote.URL = server.URL + "/slow"
+	remote.Timeout = 50 * time.Millisecond
+	values, source, err = remote.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.SourceCache, source)
+	assert.True(t, values.Has("Stuff from request Body"))
+	if assert.Len(t, errs, 1) {
+		assert.ErrorIs(t, errs[0], context.DeadlineExceeded)
+	}
+
+	// No cache either : embedded defaults
+	remote.CacheFile = ""
+	values, source, err = remote.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, constants.SourceEmbedded, source)
+	assert.True(t, values.Has("This is a simple thing"))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+}
+
+func TestGeneratedTables(t *testing.T) {
+	v, ok := constants.MaxRetries("push")
+	assert.True(t, ok)
+	assert.Equal(t, 5, v)
+	_, ok = constants.MaxRetries("fax")
+	assert.False(t, ok)
+
+	// Fails if someone edited a file in data/ without running go generate
+	checkGenerated(t, "constants", "tables.go", "-pkg", "constants")
+
+	// Only the bounds given are checked, 0 included
+	out := filepath.Join(t.TempDir(), "retries.go")
+	gentable := func(bounds ...string) (string, error) {
+		args := append([]string{"run", "thecoolthings/cmd/gentable", "-in", "data/retries.csv", "-out", out, "-pkg", "constants", "-name", "Retries"}, bounds...)
+		cmd := exec.Command("go", args...)
+		cmd.Dir = "constants"
+		b, err := cmd.CombinedOutput()
+		return string(b), err
+	}
+	b, err := gentable("-min", "1")
+	assert.NoError(t, err, b)
+	b, err = gentable("-min", "0", "-max", "0")
+	assert.Error(t, err)
+	assert.Contains(t, b, `value 3 for "mail" is above the maximum 0`)
+}
+
+// checkGenerated re-runs every go:generate line of dir/file with args and -check : it fails if
+// a generated file isn't up to date.
+func checkGenerated(t *testing.T, dir, file string, args ...string) {
+	t.Helper()
+	src, err := os.ReadFile(filepath.Join(dir, file))
+	assert.NoError(t, err)
+	for _, line := range strings.Split(string(src), "\n") {
+		if !strings.HasPrefix(line, "//go:generate go run ") {
+			continue
+		}
+		cmdArgs := append(strings.Fields(strings.TrimPrefix(line, "//go:generate go ")), args...)
+		cmd := exec.Command("go", append(cmdArgs, "-check")...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+}
+
 func TestStructsS1Mutex(t *testing.T) {
 	var s structs.S1
 	var nbRoutines = 1000
@@ -244,6 +941,749 @@ func TestStructsS1Mutex(t *testing.T) {
 	assert.Equal(t, nbRoutines, s.Len())
 }
 
+func TestStructsS1Notifications(t *testing.T) {
+	var s structs.S1
+	events, unsubscribe := s.Subscribe(structs.SubscribeOptions{Buffer: 10})
+	s.AddElement(1, 10)
+	s.AddElement(1, 10) // no change, no event
+	s.AddElement(1, 11)
+	s.DeleteElement(1)
+	s.DeleteElement(2) // not there, no event
+	assert.Equal(t, structs.Event[int, int]{Kind: structs.Added, Key: 1, New: 10}, <-events)
+	assert.Equal(t, structs.Event[int, int]{Kind: structs.Updated, Key: 1, Old: 10, New: 11}, <-events)
+	assert.Equal(t, structs.Event[int, int]{Kind: structs.Deleted, Key: 1, Old: 11}, <-events)
+	unsubscribe()
+	unsubscribe()
+	_, open := <-events
+	assert.False(t, open)
+
+	// Overflow policies, with nobody reading
+	oldest, unsubOldest := s.Subscribe(structs.SubscribeOptions{Buffer: 2, Overflow: structs.DropOldest})
+	newest, unsubNewest := s.Subscribe(structs.SubscribeOptions{Buffer: 2, Overflow: structs.DropNewest})
+	for i := 0; i < 5; i++ {
+		s.AddElement(i, i)
+	}
+	assert.Equal(t, 3, (<-oldest).Key)
+	assert.Equal(t, 4, (<-oldest).Key)
+	assert.Equal(t, 0, (<-newest).Key)
+	assert.Equal(t, 1, (<-newest).Key)
+	unsubOldest()
+	unsubNewest()
+
+	// A blocked subscriber slows down writers, but not readers
+	blocking, unsubBlocking := s.Subscribe(structs.SubscribeOptions{})
+	written := make(chan bool)
+	go func() {
+		s.AddElement(100, 100)
+		close(written)
+	}()
+	assert.Eventually(t, func() bool {
+		_, ok := s.GetElement(100)
+		return ok
+	}, time.Second, time.Millisecond)
+	select {
+	case <-written:
+		t.Fatal("AddElement should wait for the subscriber")
+	default:
+	}
+	assert.Equal(t, 100, (<-blocking).Key)
+	<-written
+
+	// Unsubscribing releases a blocked writer
+	go s.AddElement(101, 101)
+	assert.Eventually(t, func() bool { return s.Len() == 7 }, time.Second, time.Millisecond)
+	unsubBlocking()
+	s.AddElement(102, 102)
+
+	// A subscriber only gets the changes recorded after it subscribed
+	var n structs.Notifier[int, int]
+	before, unsubBefore := n.Subscribe(structs.SubscribeOptions{Buffer: 1})
+	n.Record(structs.Event[int, int]{Kind: structs.Added, Key: 1})
+	after, unsubAfter := n.Subscribe(structs.SubscribeOptions{Buffer: 1})
+	n.Deliver()
+	assert.Equal(t, 1, (<-before).Key)
+	select {
+	case e := <-after:
+		t.Fatal("event recorded before subscribing", e)
+	default:
+	}
+	unsubBefore()
+	unsubAfter()
+
+	// Concurrent writers : every subscriber sees the events in the same order
+	a, unsubA := s.Subscribe(structs.SubscribeOptions{Buffer: 1000})
+	b, unsubB := s.Subscribe(structs.SubscribeOptions{Buffer: 1000})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.AddElement(i%10, i)
+		}(i)
+	}
+	wg.Wait()
+	unsubA()
+	unsubB()
+	for e := range a {
+		assert.Equal(t, e, <-b)
+	}
+}
+
+func TestStructsS1Transactions(t *testing.T) {
+	var s structs.S1
+	s.AddElement(1, 100)
+	s.AddElement(2, 0)
+
+	move := func(from, to, amount int) func(tx *structs.Tx) error {
+		return func(tx *structs.Tx) error {
+			v, _ := tx.Get(from)
+			if v < amount {
+				return errors.New("not enough")
+			}
+			tx.Set(from, v-amount)
+			w, _ := tx.Get(to)
+			tx.Set(to, w+amount)
+			return nil
+		}
+	}
+
+	assert.NoError(t, s.Update(move(1, 2, 30)))
+	v1, _ := s.GetElement(1)
+	v2, _ := s.GetElement(2)
+	assert.Equal(t, []int{70, 30}, []int{v1, v2})
+
+	// An error rolls back every write, even those made before it
+	err := s.Update(func(tx *structs.Tx) error {
+		tx.Set(1, 0)
+		tx.Delete(2)
+		v, ok := tx.Get(2)
+		assert.Equal(t, 0, v)
+		assert.False(t, ok)
+		return errors.New("abort")
+	})
+	assert.EqualError(t, err, "abort")
+	v1, _ = s.GetElement(1)
+	v2, _ = s.GetElement(2)
+	assert.Equal(t, []int{70, 30}, []int{v1, v2})
+
+	// A panic rolls back too, and doesn't leave s locked
+	assert.Panics(t, func() {
+		_ = s.Update(func(tx *structs.Tx) error {
+			tx.Set(1, 0)
+			panic("oops")
+		})
+	})
+	s.AddElement(3, 3)
+	v1, _ = s.GetElement(1)
+	assert.Equal(t, 70, v1)
+	s.DeleteElement(3)
+
+	// The total never changes, whatever the interleaving
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = s.Update(move(1, 2, 1))
+		}()
+		go func() {
+			defer wg.Done()
+			// Retries can't run out with only 200 writers
+			assert.NoError(t, s.UpdateOptimistic(1000, move(2, 1, 1)))
+		}()
+	}
+	wg.Wait()
+	v1, _ = s.GetElement(1)
+	v2, _ = s.GetElement(2)
+	assert.Equal(t, 100, v1+v2)
+
+	// A write during fn makes it run again
+	runs := 0
+	err = s.UpdateOptimistic(1, func(tx *structs.Tx) error {
+		runs++
+		if runs == 1 {
+			s.AddElement(3, 3)
+		}
+		tx.Set(4, 4)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, runs)
+	v4, _ := s.GetElement(4)
+	assert.Equal(t, 4, v4)
+
+	err = s.UpdateOptimistic(2, func(tx *structs.Tx) error {
+		s.AddElement(3, 3+runs)
+		runs++
+		tx.Set(5, 5)
+		return nil
+	})
+	assert.ErrorIs(t, err, structs.ErrTxConflict)
+	_, ok := s.GetElement(5)
+	assert.False(t, ok)
+}
+
+func TestStructsMutex(t *testing.T) {
+	// Embedded like sync.Mutex in S1
+	var s struct {
+		structs.Mutex
+		n int
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Lock()
+			s.n++
+			time.Sleep(10 * time.Microsecond)
+			s.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, s.n)
+	stats := s.Stats()
+	assert.Equal(t, uint64(100), stats.Wait.Count)
+	assert.Equal(t, uint64(100), stats.Hold.Count)
+	assert.GreaterOrEqual(t, stats.Hold.Mean(), 10*time.Microsecond)
+	assert.GreaterOrEqual(t, stats.Hold.Percentile(50), 10*time.Microsecond)
+	// A bucket bound, at most twice the actual duration
+	assert.LessOrEqual(t, stats.Hold.Percentile(50), 2*stats.Hold.Max)
+	assert.Empty(t, s.Holder())
+
+	var h structs.Histogram
+	h.Observe(500 * time.Nanosecond)
+	h.Observe(3 * time.Microsecond)
+	h.Observe(time.Hour)
+	assert.Equal(t, uint64(1), h.Buckets[0])
+	assert.Equal(t, uint64(1), h.Buckets[2])
+	assert.Equal(t, uint64(1), h.Buckets[len(h.Buckets)-1])
+	assert.Equal(t, time.Microsecond, h.Percentile(10))
+	assert.Equal(t, time.Hour, h.Percentile(100))
+
+	// Lock order : a -> b -> c, then c -> a closes the cycle
+	var reported []*structs.LockOrderError
+	defer func(report func(*structs.LockOrderError)) { structs.ReportLockOrder = report }(structs.ReportLockOrder)
+	structs.ReportLockOrder = func(err *structs.LockOrderError) { reported = append(reported, err) }
+
+	// The graph is global : unique names, in case the test runs several times
+	prefix := fmt.Sprintf("test%d.", time.Now().UnixNano())
+	var a, b, c structs.Mutex
+	a.SetName(prefix + "a")
+	b.SetName(prefix + "b")
+	c.SetName(prefix + "c")
+	lockBoth := func(first, second *structs.Mutex) {
+		first.Lock()
+		second.Lock()
+		second.Unlock()
+		first.Unlock()
+	}
+	lockBoth(&a, &b)
+	lockBoth(&b, &c)
+	lockBoth(&a, &c)
+	assert.Empty(t, reported)
+
+	// Even from another goroutine, and without an actual deadlock
+	done := make(chan bool)
+	go func() {
+		lockBoth(&c, &a)
+		lockBoth(&c, &a)
+		close(done)
+	}()
+	<-done
+	if assert.Len(t, reported, 1) {
+		assert.Equal(t, prefix+"c", reported[0].Held)
+		assert.Equal(t, prefix+"a", reported[0].Acquired)
+		assert.Contains(t, reported[0].Error(), "potential deadlock")
+		assert.Equal(t, prefix+"a", reported[0].Cycle[0])
+		assert.Equal(t, prefix+"c", reported[0].Cycle[len(reported[0].Cycle)-1])
+	}
+
+	// TryLock, like sync.Mutex
+	assert.True(t, a.TryLock())
+	assert.False(t, a.TryLock())
+	a.Unlock()
+	assert.Equal(t, uint64(5), a.Stats().Hold.Count)
+
+	// Locking a mutex again from the goroutine holding it is reported before it blocks
+	var mu sync.Mutex
+	structs.ReportLockOrder = func(err *structs.LockOrderError) {
+		mu.Lock()
+		reported = append(reported, err)
+		mu.Unlock()
+	}
+	done = make(chan bool)
+	go func() {
+		a.Lock()
+		a.Lock() // blocks until the Unlock below
+		a.Unlock()
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reported) == 2
+	}, time.Second, time.Millisecond)
+	a.Unlock()
+	<-done
+	assert.Equal(t, prefix+"a", reported[1].Held)
+	assert.Equal(t, prefix+"a", reported[1].Acquired)
+	assert.Contains(t, reported[1].Error(), "locked again")
+}
+
+func TestStructsDeepCopy(t *testing.T) {
+	score := 10
+	orig := &structs.S4{
+		Name:     "root",
+		Tags:     []string{"a"},
+		Limits:   map[string]int{"a": 1},
+		Owner:    &structs.S2{},
+		Children: []*structs.S4{{Name: "child", Tags: []string{"b"}}, nil},
+		Groups:   map[string][]structs.S2{"g": {{}}},
+		Ranges:   [2][]int{{1, 2}, nil},
+		Scores:   structs.Scores{"s": &score},
+	}
+	orig.Lock()
+	c := orig.DeepCopy()
+	orig.Unlock()
+	assert.Equal(t, orig, c)
+
+	c.Lock() // the copy has its own, unlocked mutex
+	c.Tags[0] = "changed"
+	c.Limits["a"] = 2
+	c.Children[0].Tags[0] = "changed"
+	c.Ranges[0][0] = 0
+	*c.Scores["s"] = 0
+	c.Unlock()
+	assert.Equal(t, "a", orig.Tags[0])
+	assert.Equal(t, 1, orig.Limits["a"])
+	assert.Equal(t, "b", orig.Children[0].Tags[0])
+	assert.Nil(t, c.Children[1])
+	assert.Equal(t, 1, orig.Ranges[0][0])
+	assert.Nil(t, c.Ranges[1])
+	assert.Equal(t, 10, score)
+	assert.NotSame(t, orig.Owner, c.Owner)
+	assert.Nil(t, (*structs.S4)(nil).DeepCopy())
+
+	checkGenerated(t, "structs", "deepcopy.go")
+
+	// Without -mutex skip, S4 can't be copied
+	cmd := exec.Command("go", "run", "thecoolthings/cmd/gendeepcopy", "-out", "deepcopy_generated.go", "-check")
+	cmd.Dir = "structs"
+	out, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "S4.Mutex: sync.Mutex can't be copied")
+}
+
+func TestStructsCOWMap(t *testing.T) {
+	var m structs.COWMap[string, int]
+	_, ok := m.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, m.Len())
+
+	m.Set("a", 1)
+	before := m.Snapshot()
+	m.SetMany(map[string]int{"b": 2, "c": 3})
+	m.Delete("a")
+	v, ok := m.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 2, m.Len())
+	// Snapshots are never modified
+	assert.Equal(t, map[string]int{"a": 1}, before)
+
+	// Readers see all the changes of a batch, or none
+	var wg sync.WaitGroup
+	stop := make(chan bool)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			snapshot := m.Snapshot()
+			assert.Equal(t, snapshot["b"]+1, snapshot["c"])
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		m.Batch(func(batch map[string]int) {
+			batch["b"] = i
+			batch["c"] = i + 1
+		})
+	}
+	close(stop)
+	wg.Wait()
+
+	n := 0
+	m.Range(func(key string, val int) bool {
+		m.Set(key, val+1) // allowed
+		n++
+		return true
+	})
+	assert.Equal(t, 2, n)
+}
+
+func TestStructsMap(t *testing.T) {
+	var m structs.Map[string, int]
+	var nbRoutines = 1000
+	var wg sync.WaitGroup
+	wg.Add(nbRoutines)
+	for i := 0; i < nbRoutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			m.Set(strconv.Itoa(i), i)
+			m.Update("total", func(v int, _ bool) (int, bool) { return v + 1, true })
+			_, _ = m.Get(strconv.Itoa(i / 2))
+			m.Range(func(string, int) bool { return false })
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, nbRoutines+1, m.Len())
+	total, _ := m.Get("total")
+	assert.Equal(t, nbRoutines, total)
+
+	actual, loaded := m.LoadOrStore("1", 100)
+	assert.True(t, loaded)
+	assert.Equal(t, 1, actual)
+	actual, loaded = m.LoadOrStore("new", 100)
+	assert.False(t, loaded)
+	assert.Equal(t, 100, actual)
+
+	assert.False(t, m.CompareAndSwap("new", 1, 2))
+	assert.True(t, m.CompareAndSwap("new", 100, 2))
+	v, _ := m.Get("new")
+	assert.Equal(t, 2, v)
+
+	m.Update("new", func(int, bool) (int, bool) { return 0, false })
+	_, ok := m.Get("new")
+	assert.False(t, ok)
+
+	// Range works on a snapshot : deleting while ranging is fine
+	m.Range(func(k string, _ int) bool {
+		m.Delete(k)
+		return true
+	})
+	assert.Equal(t, 0, m.Len())
+
+	m.Set("a", 1)
+	m.Clear()
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestStructsShardedMap(t *testing.T) {
+	m := structs.NewShardedMap[int, int](16, structs.IntHash)
+	var nbRoutines = 1000
+	var wg sync.WaitGroup
+	wg.Add(nbRoutines)
+	for i := 0; i < nbRoutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			m.Set(i, i)
+			m.Update(-1, func(v int, _ bool) (int, bool) { return v + 1, true })
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, nbRoutines+1, m.Len())
+	total, _ := m.Get(-1)
+	assert.Equal(t, nbRoutines, total)
+
+	m.Delete(-1)
+	sum := 0
+	m.Range(func(k, v int) bool {
+		sum += v
+		return true
+	})
+	assert.Equal(t, nbRoutines*(nbRoutines-1)/2, sum)
+
+	s := structs.NewShardedMap[string, bool](4, structs.StringHash)
+	s.Set("a", true)
+	v, ok := s.Get("a")
+	assert.True(t, ok && v)
+}
+
+func TestStructsTTLMap(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	var evicted []string
+	var mu sync.Mutex
+	m := structs.NewTTLMap(structs.TTLOptions[string, int]{
+		DefaultTTL: time.Minute,
+		Now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+		OnEvict: func(key string, _ int) {
+			mu.Lock()
+			evicted = append(evicted, key)
+			mu.Unlock()
+		},
+	})
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	m.Set("default", 1)
+	m.SetWithTTL("short", 2, time.Second)
+	m.SetWithTTL("forever", 3, 0)
+	assert.Equal(t, 3, m.Len())
+
+	// Lazy expiry on Get
+	advance(time.Second)
+	_, ok := m.Get("short")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"short"}, evicted)
+
+	// Background expiry
+	advance(time.Minute)
+	assert.Equal(t, 1, m.Len())
+	m.StartJanitor(time.Millisecond)
+	defer m.Stop()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(evicted) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "default", evicted[1])
+
+	v, ok := m.Get("forever")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+
+	// Concurrent StartJanitor calls leave a single janitor, which Stop stops
+	m.Stop()
+	goroutines := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.StartJanitor(time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	m.Stop()
+	assert.Eventually(t, func() bool { return runtime.NumGoroutine() <= goroutines }, time.Second, time.Millisecond)
+}
+
+func TestStructsCache(t *testing.T) {
+	var evicted []string
+	onEvict := func(key string, _ int) { evicted = append(evicted, key) }
+
+	lru := structs.NewCache(structs.CacheOptions[string, int]{Policy: structs.LRU, MaxEntries: 2, OnEvict: onEvict})
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	lru.Get("a")
+	lru.Set("c", 3) // b is the least recently used
+	_, ok := lru.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, structs.CacheStats{Hits: 1, Misses: 1, Evictions: 1}, lru.Stats())
+	assert.Equal(t, 0.5, lru.Stats().HitRatio())
+
+	evicted = nil
+	lfu := structs.NewCache(structs.CacheOptions[string, int]{Policy: structs.LFU, MaxEntries: 2, OnEvict: onEvict})
+	lfu.Set("popular", 1)
+	lfu.Get("popular")
+	lfu.Get("popular")
+	lfu.Set("once", 2)
+	lfu.Set("new", 3) // "once" was used less than "popular", even if more recently
+	_, ok = lfu.Get("popular")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"once"}, evicted)
+
+	evicted = nil
+	byWeight := structs.NewCache(structs.CacheOptions[string, int]{
+		MaxWeight: 10,
+		Weight:    func(_ string, v int) int64 { return int64(v) },
+		OnEvict:   onEvict,
+	})
+	byWeight.Set("a", 4)
+	byWeight.Set("b", 4)
+	byWeight.Set("c", 4)
+	assert.Equal(t, int64(8), byWeight.Weight())
+	assert.Equal(t, []string{"a"}, evicted)
+	byWeight.Set("huge", 11)
+	_, ok = byWeight.Get("huge")
+	assert.False(t, ok)
+	assert.Equal(t, 2, byWeight.Len())
+
+	// Concurrent use, with the race detector
+	shared := structs.NewCache(structs.CacheOptions[int, int]{Policy: structs.LFU, MaxEntries: 100})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				shared.Set(i*j%150, j)
+				shared.Get(j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 100, shared.Len())
+}
+
+func TestStructsSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []structs.SnapshotFormat{structs.Gob, structs.JSON} {
+		path := filepath.Join(dir, fmt.Sprint("map", format))
+
+		var m structs.Map[int, string]
+		m.Set(1, "one")
+		m.Set(2, "two")
+		assert.NoError(t, structs.SaveSnapshot(&m, path, format))
+
+		var restored structs.Map[int, string]
+		assert.NoError(t, structs.RestoreSnapshot(&restored, path, format))
+		assert.Equal(t, m.Snapshot(), restored.Snapshot())
+
+		// Flip a byte at the end of the file : the checksum catches it
+		data, _ := os.ReadFile(path)
+		data[len(data)-2] ^= 0xff
+		assert.NoError(t, os.WriteFile(path, data, 0o644))
+		restored.Set(3, "three")
+		assert.ErrorIs(t, structs.RestoreSnapshot(&restored, path, format), structs.ErrSnapshotChecksum)
+		assert.Equal(t, 3, restored.Len())
+	}
+
+	// Background snapshots, with a last one when the context is cancelled
+	var m structs.Map[string, int]
+	path := filepath.Join(dir, "periodic")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		structs.SnapshotEvery(ctx, &m, path, structs.JSON, time.Millisecond, func(err error) { t.Error(err) })
+		close(done)
+	}()
+	m.Set("a", 1)
+	cancel()
+	<-done
+
+	var restored structs.Map[string, int]
+	assert.NoError(t, structs.RestoreSnapshot(&restored, path, structs.JSON))
+	v, _ := restored.Get("a")
+	assert.Equal(t, 1, v)
+	// Only the snapshots remain in the directory, no temporary file
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 3)
+
+	assert.ErrorIs(t, structs.RestoreSnapshot(&restored, filepath.Join(dir, "missing"), structs.JSON), fs.ErrNotExist)
+}
+
+// concurrentIntMap is what the map benchmarks below need from each implementation.
+type concurrentIntMap interface {
+	get(k int)
+	set(k, v int)
+}
+
+type s1Bench struct{ structs.S1 }
+
+func (s *s1Bench) get(k int)    { s.GetElement(k) }
+func (s *s1Bench) set(k, v int) { s.AddElement(k, v) }
+
+type shardedBench struct{ *structs.ShardedMap[int, int] }
+
+func (s shardedBench) get(k int)    { s.Get(k) }
+func (s shardedBench) set(k, v int) { s.Set(k, v) }
+
+type syncMapBench struct{ sync.Map }
+
+func (s *syncMapBench) get(k int)    { s.Load(k) }
+func (s *syncMapBench) set(k, v int) { s.Store(k, v) }
+
+type mapBench struct{ structs.Map[int, int] }
+
+func (s *mapBench) get(k int)    { s.Get(k) }
+func (s *mapBench) set(k, v int) { s.Set(k, v) }
+
+type cowBench struct{ structs.COWMap[int, int] }
+
+func (s *cowBench) get(k int)    { s.Get(k) }
+func (s *cowBench) set(k, v int) { s.Set(k, v) }
+
+// Run with -cpu 1,4,8 to see how each implementation scales.
+func BenchmarkConcurrentMaps(b *testing.B) {
+	const keys = 1024
+	implementations := []struct {
+		name string
+		new  func() concurrentIntMap
+	}{
+		{"S1", func() concurrentIntMap { return &s1Bench{} }},
+		{"Map", func() concurrentIntMap { return &mapBench{} }},
+		{"Sharded16", func() concurrentIntMap { return shardedBench{structs.NewShardedMap[int, int](16, structs.IntHash)} }},
+		{"sync.Map", func() concurrentIntMap { return &syncMapBench{} }},
+		{"COWMap", func() concurrentIntMap { return &cowBench{} }},
+	}
+	workloads := []struct {
+		name          string
+		writePermille int
+	}{
+		{"read-mostly", 1},
+		{"read-heavy", 10},
+		{"mixed", 500},
+		{"write-heavy", 990},
+	}
+
+	for _, w := range workloads {
+		for _, impl := range implementations {
+			b.Run(w.name+"/"+impl.name, func(b *testing.B) {
+				m := impl.new()
+				for k := 0; k < keys; k++ {
+					m.set(k, k)
+				}
+				var seed int64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					// Each goroutine has its own sequence of keys and writes : with the same one,
+					// they would all hit the same key, and the same shard, at the same time
+					rng := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+					i := 0
+					for pb.Next() {
+						k := rng.Intn(keys)
+						if rng.Intn(1000) < w.writePermille {
+							m.set(k, i)
+						} else {
+							m.get(k)
+						}
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+// Copying the map once for 100 writes instead of 100 times.
+func BenchmarkCOWMapWrites(b *testing.B) {
+	const keys = 1024
+	var m structs.COWMap[int, int]
+	for k := 0; k < keys; k++ {
+		m.Set(k, k)
+	}
+	b.Run("Set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for k := 0; k < 100; k++ {
+				m.Set(k, i)
+			}
+		}
+	})
+	b.Run("Batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.Batch(func(batch map[int]int) {
+				for k := 0; k < 100; k++ {
+					batch[k] = i
+				}
+			})
+		}
+	})
+}
+
 // Slower than ranging on a map, but this just shows how to make a goroutine iterator on a map, for the syntax / general idea.
 func BenchmarkIterate(b *testing.B) {
 	var (
@@ -0,0 +1,371 @@
+// Command gendeepcopy writes DeepCopy and DeepCopyInto methods for the struct types of a
+// package annotated with a //deepcopy:generate line in their doc comment. It's meant to be
+// called from a go:generate line in the package :
+//
+//	//go:generate go run thecoolthings/cmd/gendeepcopy -out deepcopy_generated.go
+//
+// Fields are copied according to their type :
+//   - values (numbers, strings, bools, time.Time...) and arrays of values are assigned
+//   - pointers, slices and maps are allocated again, and their content copied recursively
+//   - annotated structs use their own DeepCopyInto
+//
+// Anything else (interfaces, funcs, chans, structs of other packages, structs that aren't
+// annotated) is an error : sharing it silently is exactly what a deep copy must not do.
+//
+// Locks (sync.Mutex, sync.RWMutex...) can't be copied. With -mutex error (the default) they
+// are an error, with -mutex skip the copy keeps its own : an unlocked one for a new copy, or
+// a new one for a pointer to a lock.
+//
+// With -check, nothing is written : gendeepcopy exits with status 1 if -out isn't exactly what
+// it would generate.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"thecoolthings/cmd/internal/gen"
+)
+
+const annotation = "//deepcopy:generate"
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gendeepcopy: ")
+
+	var (
+		dir   = flag.String("dir", ".", "directory of the package")
+		out   = flag.String("out", "", "Go file to write, in -dir")
+		mutex = flag.String("mutex", "error", "what to do with lock fields : error or skip")
+		check = flag.Bool("check", false, "only check that -out is up to date")
+	)
+	flag.Parse()
+	if *out == "" || (*mutex != "error" && *mutex != "skip") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pkg, err := parsePackage(*dir, *out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// -dir isn't in the header : the output doesn't depend on where the package is
+	src, err := generate(pkg, *mutex == "skip", gen.Args("check", "dir"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := gen.Output(filepath.Join(*dir, *out), src, *check); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type packageInfo struct {
+	name      string
+	types     map[string]*ast.TypeSpec
+	annotated []string          // sorted
+	imports   map[string]string // path of each imported package, by name
+}
+
+// parsePackage reads the type declarations of the package in dir, except in tests and in the
+// generated file itself.
+func parsePackage(dir, generated string) (*packageInfo, error) {
+	filter := func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != generated
+	}
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, filter, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%s: want exactly one package, found %d", dir, len(pkgs))
+	}
+
+	info := &packageInfo{types: make(map[string]*ast.TypeSpec), imports: make(map[string]string)}
+	for name, pkg := range pkgs {
+		info.name = name
+		for _, file := range pkg.Files {
+			for _, imp := range file.Imports {
+				path := strings.Trim(imp.Path.Value, `"`)
+				name := filepath.Base(path)
+				if imp.Name != nil {
+					name = imp.Name.Name
+				}
+				info.imports[name] = path
+			}
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					info.types[ts.Name.Name] = ts
+					// A lone type declaration has its comment on the GenDecl
+					if annotated(ts.Doc) || (len(gen.Specs) == 1 && annotated(gen.Doc)) {
+						info.annotated = append(info.annotated, ts.Name.Name)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(info.annotated)
+	return info, nil
+}
+
+func annotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// generate returns the formatted source. args is only used in the header comment.
+func generate(pkg *packageInfo, skipLocks bool, args string) ([]byte, error) {
+	g := &generator{pkg: pkg, skipLocks: skipLocks, imports: make(map[string]bool)}
+	var body bytes.Buffer
+	for _, name := range pkg.annotated {
+		st, ok := pkg.types[name].Type.(*ast.StructType)
+		if !ok {
+			return nil, fmt.Errorf("%s: only struct types can be annotated", name)
+		}
+		if err := g.writeType(&body, name, st); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\npackage %s\n", gen.Header("gendeepcopy", args), pkg.name)
+	if len(g.imports) > 0 {
+		var imports []string
+		for path := range g.imports {
+			imports = append(imports, fmt.Sprintf("%q", path))
+		}
+		sort.Strings(imports)
+		fmt.Fprintf(&buf, "\nimport (\n%s\n)\n", strings.Join(imports, "\n"))
+	}
+	buf.Write(body.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+type generator struct {
+	pkg       *packageInfo
+	skipLocks bool
+	imports   map[string]bool // needed by the generated code
+	w         *bytes.Buffer
+}
+
+func (g *generator) writeType(w *bytes.Buffer, name string, st *ast.StructType) error {
+	g.w = w
+	fmt.Fprintf(w, "\n// DeepCopyInto copies in into out. Once done, out shares no memory with in.\n")
+	fmt.Fprintf(w, "func (in *%s) DeepCopyInto(out *%s) {\n", name, name)
+	for _, field := range st.Fields.List {
+		names := field.Names
+		if len(names) == 0 {
+			// Embedded : the field is named after its type
+			names = []*ast.Ident{{Name: embeddedName(field.Type)}}
+		}
+		for _, n := range names {
+			if n.Name == "_" {
+				continue
+			}
+			if err := g.copy("out."+n.Name, "in."+n.Name, field.Type, 0); err != nil {
+				return fmt.Errorf("%s.%s: %w", name, n.Name, err)
+			}
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+
+	fmt.Fprintf(w, "\n// DeepCopy returns a new %s sharing no memory with in.\n", name)
+	fmt.Fprintf(w, "func (in *%s) DeepCopy() *%s {\n", name, name)
+	fmt.Fprintf(w, "if in == nil {\nreturn nil\n}\nout := new(%s)\nin.DeepCopyInto(out)\nreturn out\n}\n", name)
+	return nil
+}
+
+func embeddedName(t ast.Expr) string {
+	switch t := t.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return "_"
+}
+
+// locks can't be copied, see -mutex.
+var locks = map[string]bool{
+	"sync.Mutex": true, "sync.RWMutex": true, "sync.WaitGroup": true, "sync.Once": true, "sync.Cond": true,
+}
+
+// values are types of other packages safe to assign.
+var values = map[string]bool{
+	"time.Time": true, "time.Duration": true, "time.Month": true, "time.Weekday": true,
+}
+
+// isValue tells if a plain assignment of t is already a deep copy.
+func (g *generator) isValue(t ast.Expr) bool {
+	switch t := t.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(t.Name) != nil {
+			return t.Name != "any" && t.Name != "error"
+		}
+		if ts, ok := g.pkg.types[t.Name]; ok {
+			_, isStruct := ts.Type.(*ast.StructType)
+			return !isStruct && g.isValue(ts.Type)
+		}
+	case *ast.SelectorExpr:
+		return values[types.ExprString(t)]
+	case *ast.ArrayType:
+		return t.Len != nil && g.isValue(t.Elt)
+	}
+	return false
+}
+
+// copy writes the statements copying src into dst, both of type t. depth is used to name the
+// loop variables of nested slices and maps.
+func (g *generator) copy(dst, src string, t ast.Expr, depth int) error {
+	if g.isValue(t) {
+		fmt.Fprintf(g.w, "%s = %s\n", dst, src)
+		return nil
+	}
+	typ := types.ExprString(t)
+
+	switch t := t.(type) {
+	case *ast.Ident:
+		ts, ok := g.pkg.types[t.Name]
+		if !ok {
+			return fmt.Errorf("can't deep copy %s", typ)
+		}
+		if _, isStruct := ts.Type.(*ast.StructType); !isStruct {
+			// A named slice, map or pointer : copied like its underlying type, make and new
+			// accept the named type
+			return g.copyAs(dst, src, ts.Type, t, depth)
+		}
+		if !g.isAnnotated(t.Name) {
+			return fmt.Errorf("%s isn't annotated with %s", typ, annotation)
+		}
+		fmt.Fprintf(g.w, "%s.DeepCopyInto(&%s)\n", src, dst)
+		return nil
+
+	case *ast.SelectorExpr:
+		if locks[typ] {
+			if !g.skipLocks {
+				return fmt.Errorf("%s can't be copied, use -mutex skip to leave it out", typ)
+			}
+			// out keeps its own lock
+			return nil
+		}
+		return fmt.Errorf("can't deep copy %s, it belongs to another package", typ)
+
+	case *ast.StarExpr:
+		if sel, ok := t.X.(*ast.SelectorExpr); ok && locks[types.ExprString(sel)] {
+			if !g.skipLocks {
+				return fmt.Errorf("%s can't be copied, use -mutex skip to leave it out", typ)
+			}
+			// A pointer to a lock is usually expected to be set : give the copy a new one
+			fmt.Fprintf(g.w, "if %s != nil {\n%s = new(%s)\n}\n", src, dst, g.use(sel))
+			return nil
+		}
+		fmt.Fprintf(g.w, "if %s == nil {\n%s = nil\n} else {\n", src, dst)
+		fmt.Fprintf(g.w, "%s = new(%s)\n", dst, g.use(t.X))
+		if id, ok := t.X.(*ast.Ident); ok && g.isAnnotated(id.Name) {
+			fmt.Fprintf(g.w, "%s.DeepCopyInto(%s)\n", src, dst)
+		} else if g.isValue(t.X) {
+			fmt.Fprintf(g.w, "*%s = *%s\n", dst, src)
+		} else if err := g.copy("(*"+dst+")", "(*"+src+")", t.X, depth+1); err != nil {
+			return err
+		}
+		fmt.Fprintf(g.w, "}\n")
+		return nil
+	}
+	return g.copyAs(dst, src, t, t, depth)
+}
+
+// copyAs copies slices, arrays and maps of type t. named is t, or the named type whose
+// underlying type is t.
+func (g *generator) copyAs(dst, src string, t, named ast.Expr, depth int) error {
+	suffix := ""
+	if depth > 0 {
+		suffix = fmt.Sprint(depth)
+	}
+	i, k, v, c := "i"+suffix, "k"+suffix, "v"+suffix, "c"+suffix
+
+	switch t := t.(type) {
+	case *ast.ArrayType:
+		if t.Len != nil {
+			fmt.Fprintf(g.w, "for %s := range %s {\n", i, src)
+			if err := g.copy(dst+"["+i+"]", src+"["+i+"]", t.Elt, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(g.w, "}\n")
+			return nil
+		}
+		fmt.Fprintf(g.w, "if %s == nil {\n%s = nil\n} else {\n", src, dst)
+		fmt.Fprintf(g.w, "%s = make(%s, len(%s))\n", dst, g.use(named), src)
+		if g.isValue(t.Elt) {
+			fmt.Fprintf(g.w, "copy(%s, %s)\n", dst, src)
+		} else {
+			fmt.Fprintf(g.w, "for %s := range %s {\n", i, src)
+			if err := g.copy(dst+"["+i+"]", src+"["+i+"]", t.Elt, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(g.w, "}\n")
+		}
+		fmt.Fprintf(g.w, "}\n")
+		return nil
+
+	case *ast.MapType:
+		fmt.Fprintf(g.w, "if %s == nil {\n%s = nil\n} else {\n", src, dst)
+		fmt.Fprintf(g.w, "%s = make(%s, len(%s))\n", dst, g.use(named), src)
+		fmt.Fprintf(g.w, "for %s, %s := range %s {\n", k, v, src)
+		if g.isValue(t.Value) {
+			fmt.Fprintf(g.w, "%s[%s] = %s\n", dst, k, v)
+		} else {
+			fmt.Fprintf(g.w, "var %s %s\n", c, g.use(t.Value))
+			if err := g.copy(c, v, t.Value, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(g.w, "%s[%s] = %s\n", dst, k, c)
+		}
+		fmt.Fprintf(g.w, "}\n}\n")
+		return nil
+	}
+	return fmt.Errorf("can't deep copy %s", types.ExprString(named))
+}
+
+// use returns t as written in the generated code, and adds the packages it refers to to the
+// imports of the generated file.
+func (g *generator) use(t ast.Expr) string {
+	ast.Inspect(t, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				g.imports[g.pkg.imports[id.Name]] = true
+			}
+			return false
+		}
+		return true
+	})
+	return types.ExprString(t)
+}
+
+func (g *generator) isAnnotated(name string) bool {
+	i := sort.SearchStrings(g.pkg.annotated, name)
+	return i < len(g.pkg.annotated) && g.pkg.annotated[i] == name
+}
@@ -0,0 +1,158 @@
+// Command gentable turns a JSON or CSV constant table (see constants.Loader for the formats)
+// into Go source, so the table is built by the compiler instead of at startup. It's meant to
+// be called from a go:generate line :
+//
+//	//go:generate go run thecoolthings/cmd/gentable -in data/retries.csv -out retries_table.go -name MaxRetries -kind switch
+//
+// Kinds :
+//   - map    : var Name = map[string]int{...}
+//   - slice  : two sorted arrays and func Name(key string) (int, bool), using a binary search
+//   - switch : func Name(key string) (int, bool), with one case per key
+//
+// With -check, nothing is written : gentable exits with status 1 if -out isn't exactly what it
+// would generate. Run it in CI so nobody forgets to re-run go generate after editing the table.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"thecoolthings/cmd/internal/gen"
+	"thecoolthings/constants"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gentable: ")
+
+	var (
+		in       = flag.String("in", "", "JSON or CSV table to read")
+		out      = flag.String("out", "", "Go file to write")
+		pkg      = flag.String("pkg", os.Getenv("GOPACKAGE"), "package of the generated file")
+		name     = flag.String("name", "", "name of the generated variable or function")
+		kind     = flag.String("kind", "map", "map, slice or switch")
+		required = flag.String("required", "", "comma-separated keys that must be present")
+		min      = flag.Int("min", 0, "minimum value, only checked if set")
+		max      = flag.Int("max", 0, "maximum value, only checked if set")
+		check    = flag.Bool("check", false, "only check that -out is up to date")
+	)
+	flag.Parse()
+	if *in == "" || *out == "" || *pkg == "" || *name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// The default of -min and -max is not a bound : only the ones on the command line are
+	var schema constants.Schema
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "min":
+			schema.Min = min
+		case "max":
+			schema.Max = max
+		}
+	})
+	if *required != "" {
+		schema.Required = strings.Split(*required, ",")
+	}
+	loader := &constants.Loader{FS: os.DirFS(filepath.Dir(*in))}
+	table, err := loader.Load(filepath.Base(*in), schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// -pkg isn't in the header : it comes from $GOPACKAGE when run by go generate
+	src, err := generate(table, *pkg, *name, *kind, gen.Args("check", "pkg"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := gen.Output(*out, src, *check); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var templates = map[string]*template.Template{
+	"map": template.Must(template.New("map").Parse(`
+var {{.Name}} = map[string]int{
+{{- range .Entries}}
+	{{printf "%q" .Key}}: {{.Value}},
+{{- end}}
+}
+`)),
+
+	"slice": template.Must(template.New("slice").Parse(`
+import "sort"
+
+// Sorted by key, for sort.SearchStrings.
+var _{{.Name}}Keys = [...]string{
+{{- range .Entries}}
+	{{printf "%q" .Key}},
+{{- end}}
+}
+
+var _{{.Name}}Values = [...]int{
+{{- range .Entries}}
+	{{.Value}},
+{{- end}}
+}
+
+func {{.Name}}(key string) (int, bool) {
+	i := sort.SearchStrings(_{{.Name}}Keys[:], key)
+	if i < len(_{{.Name}}Keys) && _{{.Name}}Keys[i] == key {
+		return _{{.Name}}Values[i], true
+	}
+	return 0, false
+}
+`)),
+
+	"switch": template.Must(template.New("switch").Parse(`
+func {{.Name}}(key string) (int, bool) {
+	switch key {
+{{- range .Entries}}
+	case {{printf "%q" .Key}}:
+		return {{.Value}}, true
+{{- end}}
+	}
+	return 0, false
+}
+`)),
+}
+
+type entry struct {
+	Key   string
+	Value int
+}
+
+// generate returns the formatted source. args is only used in the header comment.
+func generate(table constants.FrozenMap, pkg, name, kind, args string) ([]byte, error) {
+	tmpl, ok := templates[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown kind %q, want map, slice or switch", kind)
+	}
+
+	// FrozenMap.Range is in key order : the output is the same every time
+	var entries []entry
+	table.Range(func(key string, val int) bool {
+		entries = append(entries, entry{Key: key, Value: val})
+		return true
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\npackage %s\n", gen.Header("gentable", args), pkg)
+	err := tmpl.Execute(&buf, struct {
+		Name    string
+		Entries []entry
+	}{name, entries})
+	if err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,48 @@
+// Package gen holds what the code generators of cmd have in common : the header of the
+// generated file, and the -check mode.
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Args returns the flags set on the command line, for the header of the generated file.
+// Flags that don't change the output (-check...) must be in skip : the file checked by hand or
+// in CI must be the same as the one written by go generate.
+func Args(skip ...string) string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		for _, s := range skip {
+			if f.Name == s {
+				return
+			}
+		}
+		args = append(args, "-"+f.Name+" "+f.Value.String())
+	})
+	return strings.Join(args, " ")
+}
+
+// Header is the first line of a generated file, recognized by go vet, linters and reviews.
+func Header(command, args string) string {
+	return fmt.Sprintf("// Code generated by \"%s %s\"; DO NOT EDIT.\n", command, args)
+}
+
+// Output writes src to path. With check, nothing is written : it returns an error if path
+// isn't exactly src, so that CI can tell when someone forgot to run go generate.
+func Output(path string, src []byte, check bool) error {
+	if !check {
+		return os.WriteFile(path, src, 0o644)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, src) {
+		return fmt.Errorf("%s is stale : run go generate", path)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package constants
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Tables like `simpleConstant` don't have to live in Go source. With go:embed, the files in
+// data/ are compiled into the binary, so there is still nothing to deploy next to it, but the
+// values can be edited (or generated) without touching code.
+//
+// Two formats are supported, picked by extension :
+//   - .json : a single object of string keys to integer values
+//   - .csv  : "key,value" lines. Empty lines and lines starting with # are ignored.
+//
+// While developing, set CONSTANTS_OVERRIDE_DIR to a local directory : any file found there is
+// used instead of the embedded one, without recompiling.
+
+//go:embed data
+var embedded embed.FS
+
+// OverrideDirEnv is the environment variable read by NewLoader.
+const OverrideDirEnv = "CONSTANTS_OVERRIDE_DIR"
+
+// Schema is what a table must look like to be accepted.
+type Schema struct {
+	// Required keys must be present.
+	Required []string
+	// Every value must be at least Min and at most Max, when they're set. See Bound.
+	Min, Max *int
+}
+
+// Bound returns a pointer to v, for Schema.Min and Schema.Max.
+func Bound(v int) *int {
+	return &v
+}
+
+// LoadError points to the file, and the line when there is one, that didn't validate.
+type LoadError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Loader reads tables from FS, or from OverrideDir when the file exists there.
+type Loader struct {
+	FS          fs.FS
+	OverrideDir string
+}
+
+// NewLoader returns a Loader on the embedded data/ directory, with OverrideDir taken from
+// the CONSTANTS_OVERRIDE_DIR environment variable.
+func NewLoader() *Loader {
+	sub, err := fs.Sub(embedded, "data")
+	if err != nil {
+		// Only possible if the go:embed pattern is wrong
+		panic(err)
+	}
+	return &Loader{FS: sub, OverrideDir: os.Getenv(OverrideDirEnv)}
+}
+
+// Load reads the table called name (like "simple.json"), validates it against schema and
+// returns it frozen.
+func (l *Loader) Load(name string, schema Schema) (FrozenMap, error) {
+	data, file, err := l.read(name)
+	if err != nil {
+		return FrozenMap{}, &LoadError{File: name, Err: err}
+	}
+
+	return parseTable(file, filepath.Ext(file), data, schema)
+}
+
+// MustLoad is Load for package-level variables : a broken embedded table is a programming
+// error, and should stop the program right away.
+func (l *Loader) MustLoad(name string, schema Schema) FrozenMap {
+	m, err := l.Load(name, schema)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// read returns the content of name and the path to use in errors.
+func (l *Loader) read(name string) ([]byte, string, error) {
+	if l.OverrideDir != "" {
+		file := filepath.Join(l.OverrideDir, filepath.FromSlash(name))
+		data, err := os.ReadFile(file)
+		if err == nil {
+			return data, file, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, file, err
+		}
+	}
+
+	data, err := fs.ReadFile(l.FS, name)
+	return data, name, err
+}
+
+// parseTable parses data in format (".json" or ".csv") and validates it.
+// Errors are always a *LoadError for file.
+func parseTable(file, format string, data []byte, schema Schema) (FrozenMap, error) {
+	var entries []tableEntry
+	var err error
+	switch format {
+	case ".json":
+		entries, err = parseJSONTable(data)
+	case ".csv":
+		entries, err = parseCSVTable(data)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err == nil {
+		err = schema.validate(entries)
+	}
+	if err != nil {
+		var le *LoadError
+		if errors.As(err, &le) {
+			le.File = file
+			return FrozenMap{}, le
+		}
+		return FrozenMap{}, &LoadError{File: file, Err: err}
+	}
+
+	m := make(map[string]int, len(entries))
+	for _, e := range entries {
+		m[e.key] = e.value
+	}
+	return Freeze(m), nil
+}
+
+type tableEntry struct {
+	key   string
+	value int
+	line  int
+}
+
+func (s Schema) validate(entries []tableEntry) error {
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if seen[e.key] {
+			return &LoadError{Line: e.line, Err: fmt.Errorf("duplicate key %q", e.key)}
+		}
+		seen[e.key] = true
+		if s.Min != nil && e.value < *s.Min {
+			return &LoadError{Line: e.line, Err: fmt.Errorf("value %d for %q is below the minimum %d", e.value, e.key, *s.Min)}
+		}
+		if s.Max != nil && e.value > *s.Max {
+			return &LoadError{Line: e.line, Err: fmt.Errorf("value %d for %q is above the maximum %d", e.value, e.key, *s.Max)}
+		}
+	}
+	for _, k := range s.Required {
+		if !seen[k] {
+			return fmt.Errorf("missing required key %q", k)
+		}
+	}
+	return nil
+}
+
+// parseJSONTable reads the object token by token instead of using json.Unmarshal, to know
+// the line of every key.
+func parseJSONTable(data []byte) ([]tableEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	lineAt := func(offset int64) int {
+		return bytes.Count(data[:offset], []byte("\n")) + 1
+	}
+	fail := func(err error) error {
+		return &LoadError{Line: lineAt(dec.InputOffset()), Err: err}
+	}
+
+	if tok, err := dec.Token(); err != nil {
+		return nil, fail(err)
+	} else if tok != json.Delim('{') {
+		return nil, fail(errors.New("expected a JSON object"))
+	}
+
+	var entries []tableEntry
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fail(err)
+		}
+		key := tok.(string) // object keys are always strings
+		line := lineAt(dec.InputOffset())
+
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, fail(err)
+		}
+		num, ok := tok.(json.Number)
+		if !ok {
+			return nil, &LoadError{Line: line, Err: fmt.Errorf("value for %q is not a number", key)}
+		}
+		value, err := strconv.Atoi(num.String())
+		if err != nil {
+			return nil, &LoadError{Line: line, Err: fmt.Errorf("value for %q is not an integer", key)}
+		}
+		entries = append(entries, tableEntry{key: key, value: value, line: line})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fail(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fail(errors.New("unexpected data after the JSON object"))
+	}
+
+	return entries, nil
+}
+
+func parseCSVTable(data []byte) ([]tableEntry, error) {
+	var entries []tableEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		r := csv.NewReader(strings.NewReader(text))
+		r.FieldsPerRecord = 2
+		r.TrimLeadingSpace = true
+		record, err := r.Read()
+		if err != nil {
+			return nil, &LoadError{Line: line, Err: errors.New("expected a key,value line")}
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, &LoadError{Line: line, Err: fmt.Errorf("value for %q is not an integer", record[0])}
+		}
+		entries = append(entries, tableEntry{key: record[0], value: value, line: line})
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,72 @@
+package constants
+
+import "sort"
+
+// Go has no const maps : `simpleConstant` is a regular variable, and anyone in the package can
+// write to it. The only way to make a map read-only is to not give access to it. FrozenMap keeps
+// its map unexported, copies it on construction (so the caller's literal can't be used to change
+// it afterwards either), and only has read methods.
+//
+//	var frozenConstant = Freeze(map[string]int{
+//		"This is a simple thing": 2,
+//	})
+
+// FrozenMap is an immutable map[string]int. The zero value is an empty map.
+// Since it never changes, it is safe for concurrent use without any lock.
+type FrozenMap struct {
+	m    map[string]int
+	keys []string
+}
+
+// Freeze copies m into a new FrozenMap.
+func Freeze(m map[string]int) FrozenMap {
+	f := FrozenMap{
+		m:    make(map[string]int, len(m)),
+		keys: make([]string, 0, len(m)),
+	}
+	for k, v := range m {
+		f.m[k] = v
+		f.keys = append(f.keys, k)
+	}
+	sort.Strings(f.keys)
+
+	return f
+}
+
+func (f FrozenMap) Get(key string) (int, bool) {
+	v, ok := f.m[key]
+	return v, ok
+}
+
+func (f FrozenMap) Has(key string) bool {
+	_, ok := f.m[key]
+	return ok
+}
+
+func (f FrozenMap) Len() int {
+	return len(f.keys)
+}
+
+// Keys returns the keys in sorted order. The slice is a copy and can be modified.
+func (f FrozenMap) Keys() []string {
+	return append([]string(nil), f.keys...)
+}
+
+// Range calls fn on every element in key order, until fn returns false.
+// Unlike ranging over a map, the order is always the same.
+func (f FrozenMap) Range(fn func(key string, val int) bool) {
+	for _, k := range f.keys {
+		if !fn(k, f.m[k]) {
+			return
+		}
+	}
+}
+
+// Copy returns a regular, mutable map with the same content. Changing it doesn't change f.
+func (f FrozenMap) Copy() map[string]int {
+	m := make(map[string]int, len(f.m))
+	for k, v := range f.m {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,116 @@
+package constants
+
+import (
+	"sync"
+	"time"
+)
+
+// The closure in `constant` runs when the package loads : every program importing this package
+// pays for it, even if it never reads the value, and there is no good way to report an error
+// from there (panic, or swallow it). A Lazy value runs its initializer the first time someone
+// actually needs it, from a function that *can* return an error :
+//
+//	var remoteConstant = NewLazy(func() (interface{}, error) {
+//		req, err := http.NewRequest("GET", "https://httpbin.org/get", nil)
+//		if err != nil {
+//			return nil, err
+//		}
+//		...
+//	})
+//
+//	v, err := remoteConstant.Get()
+//
+// sync.Once alone isn't enough here : it can't retry, and a test can't reset it.
+
+// RetryPolicy decides what Get does after the initializer failed.
+type RetryPolicy int
+
+const (
+	// NeverRetry caches the error like a value : every Get returns it. This is sync.Once's behavior.
+	NeverRetry RetryPolicy = iota
+	// AlwaysRetry runs the initializer again on the next Get.
+	AlwaysRetry
+	// RetryAfterDelay runs the initializer again on the first Get after the retry delay.
+	RetryAfterDelay
+)
+
+// Lazy holds a value computed on first use. It is safe for concurrent use : concurrent Gets
+// wait for a single run of the initializer.
+type Lazy struct {
+	mu         sync.Mutex
+	policy     RetryPolicy
+	retryDelay time.Duration
+	init       func() (interface{}, error)
+	done       bool
+	value      interface{}
+	err        error
+	failedAt   time.Time
+	now        func() time.Time
+}
+
+// NewLazy returns a Lazy with the NeverRetry policy. Use SetRetryPolicy to change that.
+func NewLazy(init func() (interface{}, error)) *Lazy {
+	return &Lazy{init: init, now: time.Now}
+}
+
+// SetRetryPolicy changes what the next Gets do after a failure. delay is only used by
+// RetryAfterDelay. It is safe to call at any time, even while other goroutines call Get.
+func (l *Lazy) SetRetryPolicy(policy RetryPolicy, delay time.Duration) {
+	l.mu.Lock()
+	l.policy, l.retryDelay = policy, delay
+	l.mu.Unlock()
+}
+
+// Get returns the cached value or error, running the initializer if needed.
+func (l *Lazy) Get() (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.done && (l.err == nil || !l.shouldRetry()) {
+		return l.value, l.err
+	}
+
+	l.value, l.err = l.init()
+	l.done = true
+	if l.err != nil {
+		l.value = nil
+		l.failedAt = l.now()
+	}
+
+	return l.value, l.err
+}
+
+// MustGet is Get for values that can't fail in practice. It panics on error.
+func (l *Lazy) MustGet() interface{} {
+	v, err := l.Get()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Reset forgets the cached value or error : the next Get runs the initializer again.
+// Mostly useful between tests.
+func (l *Lazy) Reset() {
+	l.mu.Lock()
+	l.done, l.value, l.err = false, nil, nil
+	l.mu.Unlock()
+}
+
+// Override replaces the value without running the initializer, until the next Reset.
+// Tests use it to avoid network calls or to inject a specific value.
+func (l *Lazy) Override(v interface{}) {
+	l.mu.Lock()
+	l.done, l.value, l.err = true, v, nil
+	l.mu.Unlock()
+}
+
+func (l *Lazy) shouldRetry() bool {
+	switch l.policy {
+	case AlwaysRetry:
+		return true
+	case RetryAfterDelay:
+		return l.now().Sub(l.failedAt) >= l.retryDelay
+	}
+	return false
+}
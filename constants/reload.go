@@ -0,0 +1,176 @@
+package constants
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Some "constants" need to change without a restart : feature limits, retry counts...
+// A mutex around the map would work, but every read would pay for it, while writes happen
+// once in a while. atomic.Value is made for this : readers Load() the current pointer without
+// any lock, and a reload builds a whole new table and Store()s it in one step. Readers never
+// see a half-updated map, since nobody ever modifies a table that was already published
+// (it's a FrozenMap anyway).
+
+// Snapshot is one published version of a Reloadable table.
+type Snapshot struct {
+	Version  uint64
+	Values   FrozenMap
+	LoadedAt time.Time
+
+	hash [sha256.Size]byte
+}
+
+// Reloadable serves the latest valid content of a JSON or CSV table file (see Loader for the
+// formats). It is safe for concurrent use.
+type Reloadable struct {
+	file   string
+	schema Schema
+
+	current atomic.Value // *Snapshot
+
+	mu          sync.Mutex // serializes reloads and protects subscribers
+	subscribers map[chan *Snapshot]struct{}
+	modTime     time.Time
+	size        int64
+	statErr     string // last error of os.Stat in Watch, reported once
+}
+
+// NewReloadable loads file a first time. Unlike later reloads, there is no previous value to
+// fall back to, so an invalid file is an error here.
+func NewReloadable(file string, schema Schema) (*Reloadable, error) {
+	r := &Reloadable{
+		file:        file,
+		schema:      schema,
+		subscribers: make(map[chan *Snapshot]struct{}),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Get returns the current snapshot. It never blocks.
+func (r *Reloadable) Get() *Snapshot {
+	return r.current.Load().(*Snapshot)
+}
+
+// Reload reads the file again. If its content changed and is valid, it becomes the current
+// snapshot and subscribers are notified. If it's invalid, the error is returned and the
+// current snapshot is kept. changed is false when the content is the same as before.
+func (r *Reloadable) Reload() (changed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.file)
+	if err != nil {
+		return false, &LoadError{File: r.file, Err: err}
+	}
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		return false, &LoadError{File: r.file, Err: err}
+	}
+	r.modTime, r.size = info.ModTime(), info.Size()
+
+	hash := sha256.Sum256(data)
+	previous, _ := r.current.Load().(*Snapshot)
+	if previous != nil && bytes.Equal(hash[:], previous.hash[:]) {
+		// Touched, or saved without changes
+		return false, nil
+	}
+
+	values, err := parseTable(r.file, filepath.Ext(r.file), data, r.schema)
+	if err != nil {
+		return false, err
+	}
+	next := &Snapshot{Values: values, LoadedAt: time.Now(), hash: hash}
+	if previous != nil {
+		next.Version = previous.Version + 1
+	}
+	r.current.Store(next)
+
+	for ch := range r.subscribers {
+		publish(ch, next)
+	}
+	return true, nil
+}
+
+// Watch polls the file every interval and reloads it when its modification time or size
+// changed, until ctx is done. Reload errors are passed to onError (which can be nil), and the
+// previous snapshot stays in place. Polling is less elegant than inotify & co, but it works
+// the same everywhere, including on network filesystems.
+func (r *Reloadable) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !r.statChanged() {
+			continue
+		}
+		if _, err := r.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every new snapshot, and a function to stop receiving
+// them. A slow subscriber doesn't block reloads : it only ever gets the latest version it
+// missed, older ones are dropped.
+func (r *Reloadable) Subscribe() (<-chan *Snapshot, func()) {
+	ch := make(chan *Snapshot, 1)
+	r.mu.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			r.mu.Lock()
+			delete(r.subscribers, ch)
+			r.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (r *Reloadable) statChanged() bool {
+	info, err := os.Stat(r.file)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		// Let Reload report it, but only once : a deleted file fails on every tick
+		changed := err.Error() != r.statErr
+		r.statErr = err.Error()
+		return changed
+	}
+	r.statErr = ""
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// publish replaces whatever ch holds with s. Only called with r.mu held, so nobody else
+// is sending on ch at the same time.
+func publish(ch chan *Snapshot, s *Snapshot) {
+	for {
+		select {
+		case ch <- s:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
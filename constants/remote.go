@@ -0,0 +1,217 @@
+package constants
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// `constant` pretends to fetch its values from httpbin.org when the package loads. Doing it
+// for real means handling everything that can go wrong with a network call : the endpoint can
+// be slow, down, or return garbage. RemoteLoader never leaves the program without a table :
+//
+//  1. ask the endpoint, with a timeout, sending the ETag / Last-Modified of the last response
+//  2. on 200 with a valid body, use it and save it to the cache file
+//  3. on 304 Not Modified, use the cache file
+//  4. on any error, use the cache file if there is one, otherwise the embedded defaults
+//
+// The remote body uses the JSON table format (see Loader).
+
+// Source tells where the values returned by RemoteLoader.Load came from.
+type Source int
+
+const (
+	SourceRemote      Source = iota // fresh response from the endpoint
+	SourceNotModified               // the endpoint confirmed the cached copy is up to date
+	SourceCache                     // endpoint unreachable or invalid, last good response used
+	SourceEmbedded                  // nothing better was available
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceRemote:
+		return "remote"
+	case SourceNotModified:
+		return "not modified"
+	case SourceCache:
+		return "cache"
+	case SourceEmbedded:
+		return "embedded"
+	}
+	return fmt.Sprintf("Source(%d)", int(s))
+}
+
+// RemoteLoader fetches a table from URL. Only URL and Fallback are required.
+type RemoteLoader struct {
+	URL     string
+	Timeout time.Duration // 10s if zero
+	Client  *http.Client  // http.DefaultClient if nil
+	Schema  Schema
+
+	// CacheFile keeps the last good response between runs. No cache if empty.
+	CacheFile string
+	// Fallback is the name of an embedded table, read with Defaults, used when neither the
+	// endpoint nor the cache have a valid table.
+	Fallback string
+	Defaults *Loader // NewLoader() if nil
+
+	// OnError is called with the failures Load recovers from (endpoint down, invalid cache...).
+	// It can be nil.
+	OnError func(error)
+}
+
+// remoteCache is what is stored in CacheFile.
+type remoteCache struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         string `json:"body"`
+}
+
+// Load returns the best table available and where it came from. Remote and cache failures
+// are passed to OnError, not returned : err is only non-nil when even the embedded fallback
+// is invalid.
+func (r *RemoteLoader) Load(ctx context.Context) (FrozenMap, Source, error) {
+	cache, cacheErr := r.readCache()
+	if cacheErr != nil && !os.IsNotExist(cacheErr) {
+		r.report(fmt.Errorf("ignoring unreadable cache: %w", cacheErr))
+	}
+
+	values, source, err := r.fetch(ctx, cache)
+	if err == nil {
+		return values, source, nil
+	}
+	r.report(fmt.Errorf("remote table unavailable: %w", err))
+
+	if cache != nil {
+		values, err := parseTable(r.CacheFile, ".json", []byte(cache.Body), r.Schema)
+		if err == nil {
+			return values, SourceCache, nil
+		}
+		r.report(fmt.Errorf("ignoring invalid cache: %w", err))
+	}
+
+	defaults := r.Defaults
+	if defaults == nil {
+		defaults = NewLoader()
+	}
+	values, err = defaults.Load(r.Fallback, r.Schema)
+	if err != nil {
+		return FrozenMap{}, SourceEmbedded, err
+	}
+	return values, SourceEmbedded, nil
+}
+
+func (r *RemoteLoader) fetch(ctx context.Context, cache *remoteCache) (FrozenMap, Source, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return FrozenMap{}, 0, err
+	}
+	if cache != nil {
+		if cache.ETag != "" {
+			req.Header.Set("If-None-Match", cache.ETag)
+		}
+		if cache.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.LastModified)
+		}
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return FrozenMap{}, 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cache != nil:
+		values, err := parseTable(r.CacheFile, ".json", []byte(cache.Body), r.Schema)
+		return values, SourceNotModified, err
+	case resp.StatusCode != http.StatusOK:
+		return FrozenMap{}, 0, fmt.Errorf("GET %s: %s", r.URL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return FrozenMap{}, 0, err
+	}
+	values, err := parseTable(r.URL, ".json", body, r.Schema)
+	if err != nil {
+		return FrozenMap{}, 0, err
+	}
+
+	err = r.writeCache(&remoteCache{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         string(body),
+	})
+	if err != nil {
+		// The values are good, we just won't have them next time
+		r.report(fmt.Errorf("could not write cache: %w", err))
+	}
+	return values, SourceRemote, nil
+}
+
+func (r *RemoteLoader) report(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+func (r *RemoteLoader) readCache() (*remoteCache, error) {
+	if r.CacheFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(r.CacheFile)
+	if err != nil {
+		return nil, err
+	}
+	var c remoteCache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, &LoadError{File: r.CacheFile, Err: err}
+	}
+	return &c, nil
+}
+
+// writeCache writes to a temporary file first, then renames it : a crash in the middle
+// leaves the previous cache intact instead of a truncated one.
+func (r *RemoteLoader) writeCache(c *remoteCache) error {
+	if r.CacheFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.CacheFile), filepath.Base(r.CacheFile)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.CacheFile)
+}
@@ -0,0 +1,9 @@
+package constants
+
+// Tables that never change at runtime don't even need to be loaded : cmd/gentable turns them
+// into Go code, and the compiler does the rest. No startup cost, no error possible at runtime,
+// and a switch on a handful of strings is usually faster than a map lookup.
+//
+// After editing a file in data/, run "go generate ./constants".
+
+//go:generate go run thecoolthings/cmd/gentable -in data/retries.csv -out retries_table.go -name MaxRetries -kind switch -required mail,push,sms -min 0 -max 10
@@ -16,6 +16,12 @@ var simpleConstant = map[string]int{
 	"that doesn't require a closure": rand.Int(),
 }
 
+// If nobody should be able to modify it, wrap it : see frozen.go.
+var frozenConstant = Freeze(map[string]int{
+	"This is a simple thing":         2,
+	"that doesn't require a closure": rand.Int(),
+})
+
 // This is done whenever the package loads (like init()), so if anything fails, it should
 // panic right away.
 var constant = func() map[string]int {
@@ -28,3 +34,16 @@ var constant = func() map[string]int {
 		"Stuff from request Body": 1,
 	}
 }() // Call the function right away with () to make this variable the returned type
+
+// The same thing, but only built when it's first needed, and with errors handled : see lazy.go.
+var lazyConstant = NewLazy(func() (interface{}, error) {
+	req, err := http.NewRequest("GET", "https://httpbin.org/get", nil)
+	if err != nil {
+		return nil, err
+	}
+	// Read request body, do complex stuff
+	_ = req
+	return map[string]int{
+		"Stuff from request Body": 1,
+	}, nil
+})
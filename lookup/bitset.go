@@ -0,0 +1,175 @@
+package lookup
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"math/rand"
+)
+
+// The keys of LookupMapSetup are between 1 and 10 : a map spends dozens of bytes on each of
+// them, when a single bit per possible key is enough. A bitset stores bit i of word i/64 for
+// key i. Lookups are a shift and a mask, and operations between two sets handle 64 keys at a
+// time.
+//
+// The catch : the size depends on the largest key, not on the number of keys. Key 1_000_000
+// alone takes at least 122KB. Use it for small, dense integers.
+
+// Bitset is a set of non-negative ints. The zero value is an empty set ready to use, growing
+// as needed.
+type Bitset struct {
+	words []uint64
+}
+
+// NewBitset returns an empty set with room for the ints 0 to n-1, so that setting them doesn't
+// need to grow it.
+func NewBitset(n int) *Bitset {
+	return &Bitset{words: make([]uint64, 0, (n+63)/64)}
+}
+
+// LookupBitsetSetup is LookupMapSetup with a Bitset.
+func LookupBitsetSetup() (*Bitset, int) {
+	var myLookup Bitset
+	var cheat int
+
+	for i := 0; i < 10; i++ {
+		random := (rand.Int() % 10) + 1
+		if cheat == 0 {
+			cheat = random
+		}
+		myLookup.Set(random)
+	}
+
+	return &myLookup, cheat
+}
+
+// Set adds i. It panics if i is negative.
+func (b *Bitset) Set(i int) {
+	if i < 0 {
+		panic("bitset: negative int")
+	}
+	w := i / 64
+	if w >= len(b.words) {
+		b.grow(w + 1)
+	}
+	b.words[w] |= 1 << (uint(i) % 64)
+}
+
+// Clear removes i.
+func (b *Bitset) Clear(i int) {
+	if w := i / 64; i >= 0 && w < len(b.words) {
+		b.words[w] &^= 1 << (uint(i) % 64)
+	}
+}
+
+// Test tells if i is in b.
+func (b *Bitset) Test(i int) bool {
+	w := i / 64
+	return i >= 0 && w < len(b.words) && b.words[w]&(1<<(uint(i)%64)) != 0
+}
+
+// Count returns the number of ints in b.
+func (b *Bitset) Count() int {
+	n := 0
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Each calls fn on every int of b in increasing order, until fn returns false.
+func (b *Bitset) Each(fn func(i int) bool) {
+	for wi, w := range b.words {
+		for w != 0 {
+			bit := bits.TrailingZeros64(w)
+			if !fn(wi*64 + bit) {
+				return
+			}
+			// Clear the lowest bit set
+			w &= w - 1
+		}
+	}
+}
+
+// Union returns a new set with the ints in b or in o.
+func (b *Bitset) Union(o *Bitset) *Bitset {
+	long, short := b.words, o.words
+	if len(long) < len(short) {
+		long, short = short, long
+	}
+	u := &Bitset{words: append([]uint64(nil), long...)}
+	for i, w := range short {
+		u.words[i] |= w
+	}
+	return u
+}
+
+// Intersect returns a new set with the ints in both b and o.
+func (b *Bitset) Intersect(o *Bitset) *Bitset {
+	n := len(b.words)
+	if len(o.words) < n {
+		n = len(o.words)
+	}
+	i := &Bitset{words: make([]uint64, n)}
+	for k := range i.words {
+		i.words[k] = b.words[k] & o.words[k]
+	}
+	i.trim()
+	return i
+}
+
+// Difference returns a new set with the ints of b that aren't in o.
+func (b *Bitset) Difference(o *Bitset) *Bitset {
+	d := &Bitset{words: append([]uint64(nil), b.words...)}
+	for k := 0; k < len(d.words) && k < len(o.words); k++ {
+		d.words[k] &^= o.words[k]
+	}
+	d.trim()
+	return d
+}
+
+// MarshalBinary encodes b as its words in little endian, without the trailing empty ones.
+func (b *Bitset) MarshalBinary() ([]byte, error) {
+	words := b.words
+	for len(words) > 0 && words[len(words)-1] == 0 {
+		words = words[:len(words)-1]
+	}
+	data := make([]byte, 8*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint64(data[8*i:], w)
+	}
+	return data, nil
+}
+
+var ErrBitsetLength = errors.New("bitset: data length isn't a multiple of 8")
+
+// UnmarshalBinary replaces the content of b with data, as encoded by MarshalBinary.
+func (b *Bitset) UnmarshalBinary(data []byte) error {
+	if len(data)%8 != 0 {
+		return ErrBitsetLength
+	}
+	b.words = make([]uint64, len(data)/8)
+	for i := range b.words {
+		b.words[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+	return nil
+}
+
+// grow makes room for n words, at least doubling the capacity like append does.
+func (b *Bitset) grow(n int) {
+	if n <= cap(b.words) {
+		// Words after len were dropped by trim : they're empty
+		b.words = b.words[:n]
+		return
+	}
+	words := make([]uint64, n, 2*n)
+	copy(words, b.words)
+	b.words = words
+}
+
+// trim drops the trailing empty words, so that sets with the same content have the same size.
+func (b *Bitset) trim() {
+	for len(b.words) > 0 && b.words[len(b.words)-1] == 0 {
+		b.words = b.words[:len(b.words)-1]
+	}
+}
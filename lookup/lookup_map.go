@@ -5,6 +5,7 @@ import (
 	"unsafe"
 )
 
+// SizeOfBool and SizeOfStruct are rough estimates, see MeasureHeap for the real numbers.
 func SizeOfBool(m map[int]bool) interface{} {
 	var dummyInt int
 	var dummyBool bool
@@ -0,0 +1,119 @@
+package lookup
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// SizeOfBool and SizeOfStruct give an idea, but a map is more than its keys and values : there
+// are buckets (or groups), their metadata, a load factor keeping part of them empty, overflow
+// buckets... The only reliable number is what the runtime actually allocates.
+//
+// MeasureHeap asks the runtime : it collects garbage, reads the size of the live heap, builds
+// the structure, collects garbage again and reads the live heap again. The difference is what
+// the structure keeps alive. Other goroutines allocating at the same time add noise, so it's
+// done several times and the median is kept.
+//
+// TestLookupMeasureHeap logs the table for a few sizes : depending on the Go version, the bool
+// of map[int]bool can even cost nothing more than struct{}, because map slots are padded.
+
+// MeasureHeap returns the number of heap bytes kept alive by the value build(n) returns,
+// median of runs measures.
+func MeasureHeap(n, runs int, build func(n int) interface{}) uint64 {
+	if runs < 1 {
+		runs = 1
+	}
+	measures := make([]uint64, runs)
+	for i := range measures {
+		measures[i] = measureOnce(n, build)
+	}
+	sort.Slice(measures, func(i, j int) bool { return measures[i] < measures[j] })
+	return measures[runs/2]
+}
+
+func measureOnce(n int, build func(n int) interface{}) uint64 {
+	var before, after runtime.MemStats
+	// Twice : finalizers and sync.Pool can keep objects alive for one more cycle
+	runtime.GC()
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	v := build(n)
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(v)
+
+	if after.HeapAlloc < before.HeapAlloc {
+		// Something else freed more than v uses
+		return 0
+	}
+	return after.HeapAlloc - before.HeapAlloc
+}
+
+// Structure is a way of storing a set of ints, for Footprints.
+type Structure struct {
+	Name string
+	// Build returns the structure holding the ints 0 to n-1
+	Build func(n int) interface{}
+}
+
+// Structures are the usual ways of answering "is this int in here?". Keys are 0 to n-1 : a
+// best case for the bitset, which needs one bit per possible value, present or not.
+var Structures = []Structure{
+	{"map[int]bool", func(n int) interface{} {
+		m := make(map[int]bool)
+		for i := 0; i < n; i++ {
+			m[i] = true
+		}
+		return m
+	}},
+	{"map[int]struct{}", func(n int) interface{} {
+		m := make(map[int]struct{})
+		for i := 0; i < n; i++ {
+			m[i] = struct{}{}
+		}
+		return m
+	}},
+	{"sorted []int", func(n int) interface{} {
+		// Lookups with sort.SearchInts
+		s := make([]int, n)
+		for i := range s {
+			s[i] = i
+		}
+		return s
+	}},
+	{"bitset", func(n int) interface{} {
+		// Sized from the start : growing would leave up to twice the room needed
+		b := NewBitset(n)
+		for i := 0; i < n; i++ {
+			b.Set(i)
+		}
+		return b
+	}},
+}
+
+// Footprints returns a table of the heap bytes used by each structure, for each size.
+func Footprints(structures []Structure, sizes []int, runs int) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "elements\t")
+	for _, s := range structures {
+		fmt.Fprintf(w, "%s\tper element\t", s.Name)
+	}
+	fmt.Fprintln(w)
+
+	for _, n := range sizes {
+		fmt.Fprintf(w, "%d\t", n)
+		for _, s := range structures {
+			bytes := MeasureHeap(n, runs, s.Build)
+			fmt.Fprintf(w, "%d\t%.1f\t", bytes, float64(bytes)/float64(n))
+		}
+		fmt.Fprintln(w)
+	}
+	_ = w.Flush()
+	return sb.String()
+}
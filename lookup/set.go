@@ -0,0 +1,192 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// LookupMapSetup shows that map[int]struct{} is the right structure to answer "is this element
+// in here?". Set is the same map, for any comparable type, with the usual operations on sets
+// written once.
+
+// Set is a set of comparable elements. Like a map, a nil Set can be read but not added to :
+// use NewSet, or make(Set[T]).
+type Set[T comparable] map[T]struct{}
+
+func NewSet[T comparable](items ...T) Set[T] {
+	s := make(Set[T], len(items))
+	s.Add(items...)
+	return s
+}
+
+func (s Set[T]) Add(items ...T) {
+	for _, item := range items {
+		s[item] = struct{}{}
+	}
+}
+
+func (s Set[T]) Remove(items ...T) {
+	for _, item := range items {
+		delete(s, item)
+	}
+}
+
+func (s Set[T]) Has(item T) bool {
+	_, ok := s[item]
+	return ok
+}
+
+func (s Set[T]) Len() int {
+	return len(s)
+}
+
+// Items returns the elements of s, in no particular order. See Sorted.
+func (s Set[T]) Items() []T {
+	items := make([]T, 0, len(s))
+	for item := range s {
+		items = append(items, item)
+	}
+	return items
+}
+
+// Union returns a new set with the elements in s or in o.
+func (s Set[T]) Union(o Set[T]) Set[T] {
+	u := make(Set[T], len(s)+len(o))
+	for item := range s {
+		u[item] = struct{}{}
+	}
+	for item := range o {
+		u[item] = struct{}{}
+	}
+	return u
+}
+
+// Intersect returns a new set with the elements in both s and o.
+func (s Set[T]) Intersect(o Set[T]) Set[T] {
+	// Iterate over the smaller one
+	if len(o) < len(s) {
+		s, o = o, s
+	}
+	i := make(Set[T])
+	for item := range s {
+		if o.Has(item) {
+			i[item] = struct{}{}
+		}
+	}
+	return i
+}
+
+// Difference returns a new set with the elements of s that aren't in o.
+func (s Set[T]) Difference(o Set[T]) Set[T] {
+	d := make(Set[T])
+	for item := range s {
+		if !o.Has(item) {
+			d[item] = struct{}{}
+		}
+	}
+	return d
+}
+
+// SymmetricDifference returns a new set with the elements in s or in o, but not in both.
+func (s Set[T]) SymmetricDifference(o Set[T]) Set[T] {
+	d := s.Difference(o)
+	for item := range o {
+		if !s.Has(item) {
+			d[item] = struct{}{}
+		}
+	}
+	return d
+}
+
+// IsSubset tells if every element of s is in o.
+func (s Set[T]) IsSubset(o Set[T]) bool {
+	if len(s) > len(o) {
+		return false
+	}
+	for item := range s {
+		if !o.Has(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Set[T]) Equal(o Set[T]) bool {
+	return len(s) == len(o) && s.IsSubset(o)
+}
+
+// MarshalJSON encodes s as an array, sorted so that the same set is always encoded the same
+// way. Numbers and strings are sorted by value, other elements by their JSON encoding.
+func (s Set[T]) MarshalJSON() ([]byte, error) {
+	items := s.Items()
+	less := lessByValue(reflect.TypeOf((*T)(nil)).Elem())
+	if less != nil {
+		sort.Slice(items, func(i, j int) bool { return less(reflect.ValueOf(items[i]), reflect.ValueOf(items[j])) })
+	}
+	encoded := make([][]byte, len(items))
+	for i, item := range items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = b
+	}
+	if less == nil {
+		sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, b := range encoded {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// lessByValue returns < for the types Sorted accepts, named or not, or nil for the others.
+// MarshalJSON can't call Sorted : T is only comparable.
+func lessByValue(t reflect.Type) func(a, b reflect.Value) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		return func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.String:
+		return func(a, b reflect.Value) bool { return a.String() < b.String() }
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes an array, duplicates are ignored. It replaces the content of s.
+func (s *Set[T]) UnmarshalJSON(data []byte) error {
+	var items []T
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	*s = NewSet(items...)
+	return nil
+}
+
+// Ordered is the set of types supporting < : Sorted needs it, and the comparable constraint of
+// Set doesn't provide it.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+// Sorted returns the elements of s in increasing order. It's a function and not a method,
+// because a method can't add a constraint to the type parameter of Set.
+func Sorted[T Ordered](s Set[T]) []T {
+	items := s.Items()
+	sort.Slice(items, func(i, j int) bool { return items[i] < items[j] })
+	return items
+}
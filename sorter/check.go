@@ -0,0 +1,156 @@
+package sorter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// sort.Sort trusts Less and Swap blindly : if Less is inconsistent (say, "<=" instead of "<",
+// or a multi-criteria Less that forgets a case), Sort still finishes, but the result is garbage
+// and nothing tells you. CheckInterface brute-forces the contract on some sample data, so it
+// can be called from a unit test right next to the sort.Interface implementation.
+//
+// It is O(n³) on Less calls, so keep the sample small (a few dozen elements is plenty).
+
+// ContractError describes the smallest counterexample found by CheckInterface.
+// Indexes are positions in the data as it was passed to CheckInterface.
+type ContractError struct {
+	Property string
+	Indexes  []int
+	// Panic is the value Len, Less or Swap panicked with. Property is then "panic in" the
+	// method, and Indexes its arguments.
+	Panic interface{}
+}
+
+func (e *ContractError) Error() string {
+	if e.Panic != nil {
+		return fmt.Sprintf("sort.Interface: %s at indexes %v: %v", e.Property, e.Indexes, e.Panic)
+	}
+	return fmt.Sprintf("sort.Interface breaks %s at indexes %v", e.Property, e.Indexes)
+}
+
+// CheckInterface verifies that data's Less is irreflexive, asymmetric and transitive, that the
+// equivalence it defines is transitive, and that Swap actually exchanges elements. Properties involving fewer elements are checked first, and
+// indexes are tried in increasing order, so the reported counterexample is minimal.
+//
+// Swap is called on data while checking, but every swap is undone before returning, unless
+// Swap panics. A panic is returned as a ContractError, so that a method left unimplemented
+// fails the test calling CheckInterface instead of crashing it.
+func CheckInterface(sorted sort.Interface) (err error) {
+	data := &recorder{Interface: sorted}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &ContractError{Property: "panic in " + data.method, Indexes: data.indexes(), Panic: r}
+		}
+	}()
+	n := data.Len()
+
+	// Irreflexivity : nothing is less than itself.
+	for i := 0; i < n; i++ {
+		if data.Less(i, i) {
+			return &ContractError{Property: "irreflexivity", Indexes: []int{i}}
+		}
+	}
+
+	// Asymmetry : i < j and j < i can't both be true.
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if data.Less(i, j) && data.Less(j, i) {
+				return &ContractError{Property: "asymmetry", Indexes: []int{i, j}}
+			}
+		}
+	}
+
+	// Swap : after swapping i and j, element i must compare like j did, and the other way around.
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if !swapIsConsistent(data, i, j) {
+				return &ContractError{Property: "swap", Indexes: []int{i, j}}
+			}
+		}
+	}
+
+	// Transitivity : i < j and j < k means i < k. Equivalence too : if neither i < j nor j < i,
+	// i and j are equal, and i = j and j = k means i = k. A tolerance in Less, or a NaN with
+	// floats, breaks the latter.
+	equal := func(a, b int) bool { return !data.Less(a, b) && !data.Less(b, a) }
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			less := data.Less(i, j)
+			eq := !less && !data.Less(j, i)
+			if !less && !eq {
+				continue
+			}
+			for k := 0; k < n; k++ {
+				if less && data.Less(j, k) && !data.Less(i, k) {
+					return &ContractError{Property: "transitivity", Indexes: []int{i, j, k}}
+				}
+				if eq && equal(j, k) && !equal(i, k) {
+					return &ContractError{Property: "transitivity of equivalence", Indexes: []int{i, j, k}}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// swapIsConsistent records how i and j compare to every element, swaps them, and checks the
+// comparisons followed the elements. Swapping a second time must restore the initial state.
+func swapIsConsistent(data sort.Interface, i, j int) bool {
+	n := data.Len()
+	before := make([][2]bool, n)
+	for k := 0; k < n; k++ {
+		before[k] = [2]bool{data.Less(i, k), data.Less(j, k)}
+	}
+
+	data.Swap(i, j)
+	swapped := true
+	for k := 0; k < n && swapped; k++ {
+		// k itself moved if it was i or j
+		kk := k
+		if k == i {
+			kk = j
+		} else if k == j {
+			kk = i
+		}
+		swapped = data.Less(i, kk) == before[k][1] && data.Less(j, kk) == before[k][0]
+	}
+
+	data.Swap(i, j)
+	restored := true
+	for k := 0; k < n && restored; k++ {
+		restored = data.Less(i, k) == before[k][0] && data.Less(j, k) == before[k][1]
+	}
+
+	return swapped && restored
+}
+
+// recorder remembers the last method called and its arguments, to report them if it panics.
+type recorder struct {
+	sort.Interface
+	method string
+	i, j   int
+}
+
+func (r *recorder) Len() int {
+	r.method = "Len"
+	return r.Interface.Len()
+}
+
+func (r *recorder) Less(i, j int) bool {
+	r.method, r.i, r.j = "Less", i, j
+	return r.Interface.Less(i, j)
+}
+
+func (r *recorder) Swap(i, j int) {
+	r.method, r.i, r.j = "Swap", i, j
+	r.Interface.Swap(i, j)
+}
+
+func (r *recorder) indexes() []int {
+	if r.method == "Len" {
+		return nil
+	}
+	return []int{r.i, r.j}
+}
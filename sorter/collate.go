@@ -0,0 +1,133 @@
+package sorter
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sorting strings with "<" compares bytes, which is rarely what a human expects :
+//
+//	"item10" < "item2"   (because '1' < '2')
+//	"Zoe" < "alice"      (because uppercase letters come first in ASCII)
+//	"Zoe" < "Émile"      ('É' is a multi-byte character, after every ASCII one)
+//
+// The functions below are drop-in replacements for "<" that can be used anywhere a Less is
+// needed : in a sort.Interface like dataSortedByCount, in sort.Slice, or in NewSortedList.
+// They all fall back to a byte comparison when two strings only differ by what they ignore,
+// so the order is always total and sorting is deterministic.
+
+// NaturalLess compares runs of digits by their numeric value, so "item2" comes before "item10".
+// Everything else is compared rune by rune.
+func NaturalLess(a, b string) bool {
+	return compareNatural(a, b) < 0
+}
+
+// FoldLess ignores case : "alice" < "Bob" < "carol".
+func FoldLess(a, b string) bool {
+	return compareFolded(a, b, unicode.ToLower) < 0
+}
+
+// AccentFoldLess ignores case and accents on Latin letters : "Émile" < "Eric" < "eve".
+func AccentFoldLess(a, b string) bool {
+	return compareFolded(a, b, foldAccent) < 0
+}
+
+// StringsBy wraps a []string into a sort.Interface with any of the Less functions above :
+//
+//	sort.Sort(StringsBy(names, NaturalLess))
+func StringsBy(s []string, less func(a, b string) bool) sort.Interface {
+	return stringsBy{s: s, less: less}
+}
+
+type stringsBy struct {
+	s    []string
+	less func(a, b string) bool
+}
+
+func (s stringsBy) Len() int           { return len(s.s) }
+func (s stringsBy) Less(i, j int) bool { return s.less(s.s[i], s.s[j]) }
+func (s stringsBy) Swap(i, j int)      { s.s[i], s.s[j] = s.s[j], s.s[i] }
+
+func compareNatural(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			// Compare the whole numbers : skip leading zeros, then the longest number is the
+			// biggest, and numbers of the same length compare like strings.
+			ei, ej := digitsEnd(a, i), digitsEnd(b, j)
+			na, nb := strings.TrimLeft(a[i:ei], "0"), strings.TrimLeft(b[j:ej], "0")
+			if len(na) != len(nb) {
+				return compareOrdered(len(na) < len(nb), len(na) > len(nb))
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			i, j = ei, ej
+			continue
+		}
+
+		ra, sa := utf8.DecodeRuneInString(a[i:])
+		rb, sb := utf8.DecodeRuneInString(b[j:])
+		if ra != rb {
+			return compareOrdered(ra < rb, ra > rb)
+		}
+		i, j = i+sa, j+sb
+	}
+	if c := compareOrdered(i == len(a) && j < len(b), j == len(b) && i < len(a)); c != 0 {
+		return c
+	}
+
+	// Same words and numbers, like "item02" and "item2"
+	return strings.Compare(a, b)
+}
+
+// compareFolded compares a and b after applying fold to every rune.
+func compareFolded(a, b string, fold func(rune) rune) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		ra, sa := utf8.DecodeRuneInString(a[i:])
+		rb, sb := utf8.DecodeRuneInString(b[j:])
+		ra, rb = fold(ra), fold(rb)
+		if ra != rb {
+			return compareOrdered(ra < rb, ra > rb)
+		}
+		i, j = i+sa, j+sb
+	}
+	if c := compareOrdered(i == len(a) && j < len(b), j == len(b) && i < len(a)); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a, b)
+}
+
+// latinBase maps U+00C0 to U+017F (Latin-1 Supplement and Latin Extended-A) to the letter
+// without its accent. Characters that aren't accented letters (Æ, ß, ×...) map to themselves.
+// golang.org/x/text/unicode/norm does this properly for every script, but it's a whole
+// dependency for what is, most of the time, a few French or German names.
+var latinBase = []rune("" +
+	"AAAAAAÆCEEEEIIIIDNOOOOO×OUUUUYÞß" +
+	"aaaaaaæceeeeiiiidnooooo÷ouuuuyþy" +
+	"AaAaAaCcCcCcCcDdDdEeEeEeEeEeGgGg" +
+	"GgGgHhHhIiIiIiIiIiĲĳJjKkĸLlLlLlL" +
+	"lLlNnNnNnŉŊŋOoOoOoŒœRrRrRrSsSsSs" +
+	"SsTtTtTtUuUuUuUuUuUuWwYyYZzZzZzſ")
+
+func foldAccent(r rune) rune {
+	if r >= 0xC0 && r < 0xC0+rune(len(latinBase)) {
+		r = latinBase[r-0xC0]
+	}
+	return unicode.ToLower(r)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func digitsEnd(s string, i int) int {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,152 @@
+package sorter
+
+import (
+	"math"
+	"sync"
+)
+
+// "What is the rank of contact X ?" is easy to answer once : sort dataSortedByCount, then look
+// for X. But if counts change all the time, sorting everything before each question is a waste.
+// Leaderboard keeps the contacts in a SortedList, so an increment only moves one element, and
+// the rank comes from the subtree sizes instead of a scan.
+
+// LeaderboardEntry is a contact and its score, as returned by Leaderboard queries.
+type LeaderboardEntry struct {
+	IdContact            uint64
+	MessageReceivedCount uint
+}
+
+// Leaderboard ranks contacts by messageReceivedCount, highest first. Contacts with the same count
+// are ordered by idContact so that ranks are stable. It is safe for concurrent use.
+type Leaderboard struct {
+	mu     sync.RWMutex
+	counts map[uint64]uint
+	list   *SortedList
+}
+
+func NewLeaderboard() *Leaderboard {
+	return &Leaderboard{
+		counts: make(map[uint64]uint),
+		list: NewSortedList(func(a, b interface{}) bool {
+			da, db := a.(sortableData), b.(sortableData)
+			if da.messageReceivedCount != db.messageReceivedCount {
+				return da.messageReceivedCount > db.messageReceivedCount
+			}
+			return da.idContact < db.idContact
+		}),
+	}
+}
+
+func (l *Leaderboard) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.list.Len()
+}
+
+// Increment adds delta to the count of idContact, adding the contact if it wasn't there yet,
+// and returns the new count.
+func (l *Leaderboard) Increment(idContact uint64, delta uint) uint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count, exists := l.counts[idContact]
+	if exists {
+		l.list.Delete(sortableData{idContact: idContact, messageReceivedCount: count})
+	}
+	count += delta
+	l.counts[idContact] = count
+	l.list.Insert(sortableData{idContact: idContact, messageReceivedCount: count})
+
+	return count
+}
+
+// Remove takes idContact out of the leaderboard.
+func (l *Leaderboard) Remove(idContact uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if count, exists := l.counts[idContact]; exists {
+		l.list.Delete(sortableData{idContact: idContact, messageReceivedCount: count})
+		delete(l.counts, idContact)
+	}
+}
+
+// Rank returns the 1-based position of idContact, or 0 if it isn't in the leaderboard.
+func (l *Leaderboard) Rank(idContact uint64) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	count, exists := l.counts[idContact]
+	if !exists {
+		return 0
+	}
+	return l.list.Rank(sortableData{idContact: idContact, messageReceivedCount: count}) + 1
+}
+
+// Top returns at most limit entries, starting at offset (0 is the first place).
+func (l *Leaderboard) Top(offset, limit int) []LeaderboardEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if offset < 0 {
+		offset = 0
+	}
+	total := l.list.Len()
+	if offset >= total || limit <= 0 {
+		return nil
+	}
+	// Not offset+limit, which overflows for a huge limit
+	if limit > total-offset {
+		limit = total - offset
+	}
+	page := make([]LeaderboardEntry, 0, limit)
+	for i := offset; i < offset+limit; i++ {
+		page = append(page, toEntry(l.list.At(i)))
+	}
+
+	return page
+}
+
+// Percentile returns the percentage of contacts that received strictly fewer messages than
+// idContact, between 0 and 100. ok is false if idContact isn't in the leaderboard.
+func (l *Leaderboard) Percentile(idContact uint64) (p float64, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	count, exists := l.counts[idContact]
+	if !exists {
+		return 0, false
+	}
+	if count == 0 {
+		return 0, true
+	}
+	// Everything ranked before {0, count-1} has at least count messages
+	atLeast := l.list.Rank(sortableData{idContact: 0, messageReceivedCount: count - 1})
+	total := l.list.Len()
+
+	return 100 * float64(total-atLeast) / float64(total), true
+}
+
+// AtPercentile returns the entry that has p percent of the leaderboard below it :
+// AtPercentile(90) is the last contact of the top 10%. ok is false when the leaderboard is empty.
+func (l *Leaderboard) AtPercentile(p float64) (e LeaderboardEntry, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	total := l.list.Len()
+	if total == 0 {
+		return LeaderboardEntry{}, false
+	}
+	p = math.Max(0, math.Min(100, p))
+	i := int(math.Ceil(float64(total)*(100-p)/100)) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return toEntry(l.list.At(i)), true
+}
+
+func toEntry(v interface{}) LeaderboardEntry {
+	d := v.(sortableData)
+	return LeaderboardEntry{IdContact: d.idContact, MessageReceivedCount: d.messageReceivedCount}
+}
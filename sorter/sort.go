@@ -55,6 +55,8 @@ func (d dataSortedByIdContact) Swap(i, j int) {
 //  Red 14, Red 24, Blue 16, Yellow 12, Yellow 25
 //
 // Red, then blue, then yellow (TColor's order), AND ages going up.
+//
+//go:generate stringer -type TColor
 type TColor int
 
 const (
@@ -66,8 +68,8 @@ const (
 )
 
 type ColoredHouse struct {
-	Color         TColor
-	InhabitantAge int
+	Color         TColor `sort:"color"`
+	InhabitantAge int    `sort:"age"`
 }
 
 type PerfectStreet []ColoredHouse
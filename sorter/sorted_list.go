@@ -0,0 +1,183 @@
+package sorter
+
+import "math/rand"
+
+// Calling sort.Sort(dataSortedByCount(data)) after every single update works, but costs
+// O(n log n) each time, when only one element moved. If the data needs to be sorted *all the
+// time*, it's better to store it in a structure that never gets out of order.
+//
+// SortedList is a treap : a binary search tree where every node also gets a random priority,
+// and parents always have a higher priority than their children. The random priorities keep
+// the tree balanced on average, so inserts, deletes and lookups are O(log n), with much less
+// code than a red-black tree. Each node also knows the size of its subtree, which is what
+// makes "give me the 10th element" or "how many elements are before this one" cheap.
+
+// SortedList keeps its elements ordered with the less function given to NewSortedList.
+// Equal elements (neither is less than the other) are kept in insertion order.
+// It is not safe for concurrent use.
+type SortedList struct {
+	root *treapNode
+	less func(a, b interface{}) bool
+}
+
+type treapNode struct {
+	value       interface{}
+	priority    uint32
+	size        int
+	left, right *treapNode
+}
+
+// NewSortedList works like sort.Slice : less tells whether a should be before b.
+//
+//	byCount := NewSortedList(func(a, b interface{}) bool {
+//		return a.(sortableData).messageReceivedCount < b.(sortableData).messageReceivedCount
+//	})
+func NewSortedList(less func(a, b interface{}) bool) *SortedList {
+	return &SortedList{less: less}
+}
+
+func (l *SortedList) Len() int {
+	return l.root.len()
+}
+
+// Insert adds v after any element equal to it.
+func (l *SortedList) Insert(v interface{}) {
+	left, right := l.split(l.root, v, true)
+	n := &treapNode{value: v, priority: rand.Uint32(), size: 1}
+	l.root = merge(merge(left, n), right)
+}
+
+// Delete removes one element equal to v, and returns false if there was none.
+func (l *SortedList) Delete(v interface{}) bool {
+	left, rest := l.split(l.root, v, false)
+	equal, right := l.split(rest, v, true)
+	found := equal != nil
+	if found {
+		// Every node in "equal" is equal to v : dropping its root is enough
+		equal = merge(equal.left, equal.right)
+	}
+	l.root = merge(merge(left, equal), right)
+
+	return found
+}
+
+// At returns the element at index i in sorted order ("select"). It panics if i is out of range,
+// like indexing a slice would.
+func (l *SortedList) At(i int) interface{} {
+	if i < 0 || i >= l.Len() {
+		panic("sorter: SortedList index out of range")
+	}
+	n := l.root
+	for {
+		switch leftSize := n.left.len(); {
+		case i < leftSize:
+			n = n.left
+		case i == leftSize:
+			return n.value
+		default:
+			i -= leftSize + 1
+			n = n.right
+		}
+	}
+}
+
+// Rank returns how many elements are strictly less than v, which is also the index v
+// would have if it was inserted before its equals.
+func (l *SortedList) Rank(v interface{}) int {
+	rank := 0
+	for n := l.root; n != nil; {
+		if l.less(n.value, v) {
+			rank += n.left.len() + 1
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	return rank
+}
+
+// Range calls fn in order on every element e with from <= e < to, until fn returns false.
+func (l *SortedList) Range(from, to interface{}, fn func(v interface{}) bool) {
+	l.walk(l.root, func(v interface{}) bool { return !l.less(v, from) }, func(v interface{}) bool { return l.less(v, to) }, fn)
+}
+
+// Each calls fn on every element in order, until fn returns false.
+func (l *SortedList) Each(fn func(v interface{}) bool) {
+	always := func(interface{}) bool { return true }
+	l.walk(l.root, always, always, fn)
+}
+
+// walk visits, in order, the nodes that are both afterLow and beforeHigh, skipping whole
+// subtrees that are out of bounds. It returns false once fn asked to stop.
+func (l *SortedList) walk(n *treapNode, afterLow, beforeHigh func(interface{}) bool, fn func(interface{}) bool) bool {
+	if n == nil {
+		return true
+	}
+	low, high := afterLow(n.value), beforeHigh(n.value)
+	// If n is before the range, everything on its left is too
+	if low && !l.walk(n.left, afterLow, beforeHigh, fn) {
+		return false
+	}
+	if low && high && !fn(n.value) {
+		return false
+	}
+	if high {
+		return l.walk(n.right, afterLow, beforeHigh, fn)
+	}
+
+	return true
+}
+
+// split cuts n in two trees : elements less than v on the left, the others on the right.
+// With orEqual, elements equal to v go to the left tree too.
+func (l *SortedList) split(n *treapNode, v interface{}, orEqual bool) (*treapNode, *treapNode) {
+	if n == nil {
+		return nil, nil
+	}
+	var goesLeft bool
+	if orEqual {
+		goesLeft = !l.less(v, n.value)
+	} else {
+		goesLeft = l.less(n.value, v)
+	}
+
+	if goesLeft {
+		var right *treapNode
+		n.right, right = l.split(n.right, v, orEqual)
+		return n.update(), right
+	}
+	var left *treapNode
+	left, n.left = l.split(n.left, v, orEqual)
+
+	return left, n.update()
+}
+
+// merge joins two trees, when every element of a is before every element of b.
+func merge(a, b *treapNode) *treapNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a.right = merge(a.right, b)
+		return a.update()
+	}
+	b.left = merge(a, b.left)
+
+	return b.update()
+}
+
+func (n *treapNode) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *treapNode) update() *treapNode {
+	n.size = n.left.len() + n.right.len() + 1
+	return n
+}
@@ -0,0 +1,192 @@
+package sorter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// API clients usually send the order they want as a string, like "color:asc,age:desc".
+// Instead of mapping every possible string to a hand-written Less, the struct can declare
+// which fields are sortable with a tag, and reflection does the rest :
+//
+//	type ColoredHouse struct {
+//		Color         TColor `sort:"color"`
+//		InhabitantAge int    `sort:"age"`
+//	}
+//
+// Fields without a `sort` tag can't be used in a spec, so clients can't sort on anything
+// that wasn't meant to be public.
+
+var (
+	ErrUnknownField    = errors.New("unknown sort field")
+	ErrUnsortableField = errors.New("field is not sortable")
+	ErrInvalidSpec     = errors.New("invalid sort spec")
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SortKey is one "name:direction" element of a spec.
+type SortKey struct {
+	Name string
+	Desc bool
+
+	index   int
+	compare func(a, b reflect.Value) int
+}
+
+// SortSpec is a parsed spec, bound to the struct type it was parsed for.
+type SortSpec struct {
+	Keys []SortKey
+
+	elemType reflect.Type
+}
+
+// ParseSortSpec parses a comma-separated list of "name[:asc|desc]" for the struct type of model.
+// Names are matched against `sort` struct tags. The direction defaults to asc.
+// Integer (including enums like TColor), float, string and time.Time fields are sortable.
+func ParseSortSpec(spec string, model interface{}) (*SortSpec, error) {
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: model must be a struct, got %v", ErrInvalidSpec, t)
+	}
+
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, ok := f.Tag.Lookup("sort"); ok && name != "-" {
+			if other, dup := fields[name]; dup {
+				return nil, fmt.Errorf("%w: %s and %s both have the sort tag %q", ErrInvalidSpec, other.Name, f.Name, name)
+			}
+			fields[name] = f
+		}
+	}
+
+	s := &SortSpec{elemType: t}
+	if strings.TrimSpace(spec) == "" {
+		return s, nil
+	}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		name, dir := strings.TrimSpace(part), "asc"
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, dir = strings.TrimSpace(name[:i]), strings.TrimSpace(name[i+1:])
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%w: empty field name in %q", ErrInvalidSpec, spec)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %q is used twice", ErrInvalidSpec, name)
+		}
+		seen[name] = true
+
+		key := SortKey{Name: name}
+		switch strings.ToLower(dir) {
+		case "asc":
+		case "desc":
+			key.Desc = true
+		default:
+			return nil, fmt.Errorf("%w: direction %q for %q, want asc or desc", ErrInvalidSpec, dir, name)
+		}
+
+		f, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q on %v", ErrUnknownField, name, t)
+		}
+		if f.PkgPath != "" {
+			return nil, fmt.Errorf("%w: %q (%s) is unexported", ErrUnsortableField, name, f.Name)
+		}
+		if key.compare = comparerFor(f.Type); key.compare == nil {
+			return nil, fmt.Errorf("%w: %q (%s) has type %v", ErrUnsortableField, name, f.Name, f.Type)
+		}
+		key.index = f.Index[0]
+		s.Keys = append(s.Keys, key)
+	}
+
+	return s, nil
+}
+
+// Sort sorts slice, which must be a []T of the spec's struct type. The sort is stable, so
+// elements equal on every key keep their order.
+func (s *SortSpec) Sort(slice interface{}) error {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice || v.Type().Elem() != s.elemType {
+		return fmt.Errorf("%w: cannot sort %T with a spec for %v", ErrInvalidSpec, slice, s.elemType)
+	}
+	if len(s.Keys) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(slice, func(i, j int) bool {
+		a, b := v.Index(i), v.Index(j)
+		for _, k := range s.Keys {
+			c := k.compare(a.Field(k.index), b.Field(k.index))
+			if c == 0 {
+				continue
+			}
+			if k.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	return nil
+}
+
+// SortBy parses spec for the element type of slice and sorts it in one go.
+func SortBy(slice interface{}, spec string) error {
+	t := reflect.TypeOf(slice)
+	if t == nil || t.Kind() != reflect.Slice {
+		return fmt.Errorf("%w: cannot sort %T", ErrInvalidSpec, slice)
+	}
+	s, err := ParseSortSpec(spec, reflect.Zero(t.Elem()).Interface())
+	if err != nil {
+		return err
+	}
+
+	return s.Sort(slice)
+}
+
+// comparerFor returns a three-way comparison for values of type t, or nil if t isn't sortable.
+func comparerFor(t reflect.Type) func(a, b reflect.Value) int {
+	if t == timeType {
+		return func(a, b reflect.Value) int {
+			ta, tb := a.Interface().(time.Time), b.Interface().(time.Time)
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(a, b reflect.Value) int { return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(a, b reflect.Value) int { return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		return func(a, b reflect.Value) int { return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float()) }
+	case reflect.String:
+		return func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) }
+	}
+
+	return nil
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
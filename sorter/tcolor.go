@@ -0,0 +1,84 @@
+package sorter
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// String() comes from go:generate stringer (see tcolor_string.go), like stringer.MessageType.
+// The rest is what an enum needs to travel outside of the program : logs, JSON, databases.
+// Everything goes through the name, never the int, so reordering the constants is safe for
+// anything that was stored.
+//
+// Implementing encoding.TextMarshaler and encoding.TextUnmarshaler is enough for encoding/json :
+// it uses them for values *and* for map keys, so there is no need to write MarshalJSON.
+
+// Values returns every valid TColor, in order.
+func Values() []TColor {
+	values := make([]TColor, len(_TColor_index)-1)
+	for i := range values {
+		values[i] = TColor(i)
+	}
+	return values
+}
+
+// IsValid is false for values that aren't one of the TColor constants, like TColor(42).
+func (c TColor) IsValid() bool {
+	return c >= 0 && int(c) < len(_TColor_index)-1
+}
+
+// ParseTColor returns the TColor with the given name. Case is ignored ("red" works), but
+// unknown names are always an error : there is no default color.
+func ParseTColor(name string) (TColor, error) {
+	for _, c := range Values() {
+		if strings.EqualFold(name, c.String()) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("sorter: unknown TColor %q", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c TColor) MarshalText() ([]byte, error) {
+	if !c.IsValid() {
+		return nil, fmt.Errorf("sorter: invalid TColor %d", int(c))
+	}
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *TColor) UnmarshalText(text []byte) error {
+	parsed, err := ParseTColor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+// Value implements driver.Valuer : colors are stored by name.
+func (c TColor) Value() (driver.Value, error) {
+	if !c.IsValid() {
+		return nil, fmt.Errorf("sorter: invalid TColor %d", int(c))
+	}
+	return c.String(), nil
+}
+
+// Scan implements sql.Scanner. It reads names from text columns and, for older tables,
+// numbers from integer columns. NULL is an error : use a sql.NullString if the column allows it.
+func (c *TColor) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return c.UnmarshalText([]byte(v))
+	case []byte:
+		return c.UnmarshalText(v)
+	case int64:
+		if !TColor(v).IsValid() || int64(TColor(v)) != v {
+			return fmt.Errorf("sorter: invalid TColor %d", v)
+		}
+		*c = TColor(v)
+		return nil
+	}
+	return fmt.Errorf("sorter: cannot scan %T into TColor", src)
+}
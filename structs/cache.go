@@ -0,0 +1,241 @@
+package structs
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+)
+
+// Same pattern as S1 (a map and the mutex protecting it), but the map can't grow forever :
+// when it's full, something has to go. Which entry goes is the eviction policy :
+//   - LRU (least recently used) : a linked list ordered by last access. Every Get moves the
+//     entry to the front, and the back of the list is evicted. Good when recent entries are
+//     likely to be asked again.
+//   - LFU (least frequently used) : a heap ordered by number of accesses, ties broken by last
+//     access. Good when some entries are always popular, and shouldn't be pushed out by a burst
+//     of entries asked only once.
+//
+// Capacity is either a number of entries, or a total weight computed by a function given by
+// the caller (a size in bytes, usually), or both.
+
+type EvictionPolicy int
+
+const (
+	LRU EvictionPolicy = iota
+	LFU
+)
+
+// CacheOptions configures a Cache. At least one of MaxEntries and MaxWeight should be set,
+// otherwise the cache never evicts anything.
+type CacheOptions[K comparable, V any] struct {
+	Policy     EvictionPolicy
+	MaxEntries int
+	// MaxWeight is checked against the sum of Weight(key, val) of every entry.
+	// An entry heavier than MaxWeight on its own is never stored.
+	MaxWeight int64
+	Weight    func(key K, val V) int64
+	// OnEvict is called, without any lock held, for every entry evicted to make room.
+	OnEvict func(key K, val V)
+}
+
+// CacheStats are counters since the creation of the cache.
+type CacheStats struct {
+	Hits, Misses, Evictions uint64
+}
+
+// HitRatio is the share of Gets that found their key, between 0 and 1.
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Cache is a size-bounded concurrent map. Use NewCache to create one.
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	opts   CacheOptions[K, V]
+	items  map[K]*cacheItem[K, V]
+	order  evictionOrder[K, V]
+	weight int64
+	tick   uint64
+	stats  CacheStats
+}
+
+type cacheItem[K comparable, V any] struct {
+	key    K
+	val    V
+	weight int64
+
+	// LRU
+	elem *list.Element
+	// LFU
+	freq     uint64
+	lastUsed uint64
+	index    int
+}
+
+// evictionOrder is implemented by each policy.
+type evictionOrder[K comparable, V any] interface {
+	add(it *cacheItem[K, V])
+	touch(it *cacheItem[K, V])
+	remove(it *cacheItem[K, V])
+	victim() *cacheItem[K, V]
+}
+
+func NewCache[K comparable, V any](opts CacheOptions[K, V]) *Cache[K, V] {
+	c := &Cache[K, V]{opts: opts, items: make(map[K]*cacheItem[K, V])}
+	if opts.Policy == LFU {
+		c.order = &lfuHeap[K, V]{}
+	} else {
+		c.order = &lruList[K, V]{l: list.New()}
+	}
+	return c
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	it, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	c.stats.Hits++
+	c.touch(it)
+	return it.val, true
+}
+
+// Set adds or replaces key, evicting other entries if needed.
+func (c *Cache[K, V]) Set(key K, val V) {
+	var w int64
+	if c.opts.Weight != nil {
+		w = c.opts.Weight(key, val)
+	}
+
+	c.mu.Lock()
+	var evicted []*cacheItem[K, V]
+	it, exists := c.items[key]
+	if exists {
+		// Take it out while making room, so it isn't its own victim
+		c.order.remove(it)
+		delete(c.items, key)
+		c.weight -= it.weight
+	} else {
+		it = &cacheItem[K, V]{key: key}
+	}
+
+	if c.opts.MaxWeight > 0 && w > c.opts.MaxWeight {
+		// Would never fit : drop it, including the old value if there was one
+		if exists {
+			evicted = append(evicted, it)
+		}
+	} else {
+		it.val, it.weight = val, w
+		for len(c.items) > 0 && c.overflows(w) {
+			v := c.order.victim()
+			c.order.remove(v)
+			delete(c.items, v.key)
+			c.weight -= v.weight
+			evicted = append(evicted, v)
+		}
+		c.items[key] = it
+		c.weight += w
+		c.order.add(it)
+		c.touch(it)
+	}
+	c.stats.Evictions += uint64(len(evicted))
+	c.mu.Unlock()
+
+	if c.opts.OnEvict != nil {
+		for _, v := range evicted {
+			c.opts.OnEvict(v.key, v.val)
+		}
+	}
+}
+
+// Delete removes key. It doesn't count as an eviction.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if it, ok := c.items[key]; ok {
+		c.order.remove(it)
+		delete(c.items, key)
+		c.weight -= it.weight
+	}
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Weight returns the total weight of the entries.
+func (c *Cache[K, V]) Weight() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.weight
+}
+
+func (c *Cache[K, V]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// overflows tells if adding one more entry weighing w would go over capacity.
+func (c *Cache[K, V]) overflows(w int64) bool {
+	return (c.opts.MaxEntries > 0 && len(c.items)+1 > c.opts.MaxEntries) ||
+		(c.opts.MaxWeight > 0 && c.weight+w > c.opts.MaxWeight)
+}
+
+func (c *Cache[K, V]) touch(it *cacheItem[K, V]) {
+	c.tick++
+	it.freq++
+	it.lastUsed = c.tick
+	c.order.touch(it)
+}
+
+type lruList[K comparable, V any] struct {
+	l *list.List // front : most recently used
+}
+
+func (o *lruList[K, V]) add(it *cacheItem[K, V])    { it.elem = o.l.PushFront(it) }
+func (o *lruList[K, V]) touch(it *cacheItem[K, V])  { o.l.MoveToFront(it.elem) }
+func (o *lruList[K, V]) remove(it *cacheItem[K, V]) { o.l.Remove(it.elem) }
+func (o *lruList[K, V]) victim() *cacheItem[K, V]   { return o.l.Back().Value.(*cacheItem[K, V]) }
+
+// lfuHeap implements heap.Interface : the root is the least frequently used item.
+type lfuHeap[K comparable, V any] []*cacheItem[K, V]
+
+func (o *lfuHeap[K, V]) add(it *cacheItem[K, V])    { heap.Push(o, it) }
+func (o *lfuHeap[K, V]) touch(it *cacheItem[K, V])  { heap.Fix(o, it.index) }
+func (o *lfuHeap[K, V]) remove(it *cacheItem[K, V]) { heap.Remove(o, it.index) }
+func (o *lfuHeap[K, V]) victim() *cacheItem[K, V]   { return (*o)[0] }
+
+func (o lfuHeap[K, V]) Len() int { return len(o) }
+func (o lfuHeap[K, V]) Less(i, j int) bool {
+	if o[i].freq != o[j].freq {
+		return o[i].freq < o[j].freq
+	}
+	return o[i].lastUsed < o[j].lastUsed
+}
+func (o lfuHeap[K, V]) Swap(i, j int) {
+	o[i], o[j] = o[j], o[i]
+	o[i].index, o[j].index = i, j
+}
+func (o *lfuHeap[K, V]) Push(x any) {
+	it := x.(*cacheItem[K, V])
+	it.index = len(*o)
+	*o = append(*o, it)
+}
+func (o *lfuHeap[K, V]) Pop() any {
+	old := *o
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*o = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,90 @@
+package structs
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Even with a sync.RWMutex, every reader of Map writes to the mutex (to count readers), and
+// CPUs fight over that memory. When writes are very rare, there is a cheaper way : readers
+// don't lock anything, they load the current map from an atomic.Value and read it. The map
+// they get is never modified : a writer copies it, changes the copy, and stores the copy in
+// place of the old map. Readers still using the old one are unaffected.
+//
+// Every write copies the whole map, so writes get slower as the map grows. Batch makes many
+// changes with a single copy. See BenchmarkConcurrentMaps for the numbers.
+
+// COWMap is a copy-on-write map. The zero value is an empty map ready to use.
+// A COWMap must not be copied after first use.
+type COWMap[K comparable, V any] struct {
+	// Serializes writers, readers never touch it
+	mu sync.Mutex
+	// Holds a map[K]V, never modified once stored
+	current atomic.Value
+}
+
+// load returns the current map, nil if nothing was stored yet. Reading a nil map is fine.
+func (s *COWMap[K, V]) load() map[K]V {
+	m, _ := s.current.Load().(map[K]V)
+	return m
+}
+
+func (s *COWMap[K, V]) Get(key K) (V, bool) {
+	v, ok := s.load()[key]
+	return v, ok
+}
+
+func (s *COWMap[K, V]) Len() int {
+	return len(s.load())
+}
+
+// Snapshot returns the current content, without copying it : it is shared with every other
+// reader and must not be modified.
+func (s *COWMap[K, V]) Snapshot() map[K]V {
+	return s.load()
+}
+
+// Range calls fn on every element until fn returns false. It iterates over the map as it was
+// when Range was called, so fn is free to modify s.
+func (s *COWMap[K, V]) Range(fn func(key K, val V) bool) {
+	for k, v := range s.load() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+func (s *COWMap[K, V]) Set(key K, val V) {
+	s.Batch(func(m map[K]V) {
+		m[key] = val
+	})
+}
+
+func (s *COWMap[K, V]) Delete(key K) {
+	s.Batch(func(m map[K]V) {
+		delete(m, key)
+	})
+}
+
+// SetMany sets every key of entries, with a single copy.
+func (s *COWMap[K, V]) SetMany(entries map[K]V) {
+	s.Batch(func(m map[K]V) {
+		for k, v := range entries {
+			m[k] = v
+		}
+	})
+}
+
+// Batch calls fn on a copy of the map, then replaces the map with it : readers see either
+// none or all of the changes of fn. fn must not keep m, nor call methods of s that write.
+func (s *COWMap[K, V]) Batch(fn func(m map[K]V)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.load()
+	m := make(map[K]V, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	fn(m)
+	s.current.Store(m)
+}
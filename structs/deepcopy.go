@@ -0,0 +1,39 @@
+package structs
+
+import (
+	"sync"
+	"time"
+)
+
+// S2.ReadOnlyMethod gets a copy of s, so it can't change the original... as long as S2 only
+// has values. A copy of a slice, a map or a pointer still points to the same memory : writing
+// through the copy writes to the original. S4 has all of those.
+//
+// A deep copy allocates all of them again. Writing one by hand for each structure is tedious,
+// and easy to forget when adding a field : cmd/gendeepcopy writes them, for every struct with
+// a //deepcopy:generate line in its doc comment.
+//
+// After changing an annotated struct, run "go generate ./structs".
+
+//go:generate go run thecoolthings/cmd/gendeepcopy -out deepcopy_generated.go -mutex skip
+
+// S4 is like S2, with fields a value receiver doesn't protect.
+//
+//deepcopy:generate
+type S4 struct {
+	// Never copied : the copy gets its own, unlocked
+	sync.Mutex
+
+	Name     string
+	Created  time.Time
+	Tags     []string
+	Limits   map[string]int
+	Owner    *S2
+	Children []*S4
+	Groups   map[string][]S2
+	Ranges   [2][]int
+	Scores   Scores
+}
+
+// Scores is copied like a map, no need to annotate it.
+type Scores map[string]*int
@@ -0,0 +1,107 @@
+// Code generated by "gendeepcopy -mutex skip -out deepcopy_generated.go"; DO NOT EDIT.
+
+package structs
+
+// DeepCopyInto copies in into out. Once done, out shares no memory with in.
+func (in *S2) DeepCopyInto(out *S2) {
+	out.attr = in.attr
+}
+
+// DeepCopy returns a new S2 sharing no memory with in.
+func (in *S2) DeepCopy() *S2 {
+	if in == nil {
+		return nil
+	}
+	out := new(S2)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies in into out. Once done, out shares no memory with in.
+func (in *S4) DeepCopyInto(out *S4) {
+	out.Name = in.Name
+	out.Created = in.Created
+	if in.Tags == nil {
+		out.Tags = nil
+	} else {
+		out.Tags = make([]string, len(in.Tags))
+		copy(out.Tags, in.Tags)
+	}
+	if in.Limits == nil {
+		out.Limits = nil
+	} else {
+		out.Limits = make(map[string]int, len(in.Limits))
+		for k, v := range in.Limits {
+			out.Limits[k] = v
+		}
+	}
+	if in.Owner == nil {
+		out.Owner = nil
+	} else {
+		out.Owner = new(S2)
+		in.Owner.DeepCopyInto(out.Owner)
+	}
+	if in.Children == nil {
+		out.Children = nil
+	} else {
+		out.Children = make([]*S4, len(in.Children))
+		for i := range in.Children {
+			if in.Children[i] == nil {
+				out.Children[i] = nil
+			} else {
+				out.Children[i] = new(S4)
+				in.Children[i].DeepCopyInto(out.Children[i])
+			}
+		}
+	}
+	if in.Groups == nil {
+		out.Groups = nil
+	} else {
+		out.Groups = make(map[string][]S2, len(in.Groups))
+		for k, v := range in.Groups {
+			var c []S2
+			if v == nil {
+				c = nil
+			} else {
+				c = make([]S2, len(v))
+				for i1 := range v {
+					v[i1].DeepCopyInto(&c[i1])
+				}
+			}
+			out.Groups[k] = c
+		}
+	}
+	for i := range in.Ranges {
+		if in.Ranges[i] == nil {
+			out.Ranges[i] = nil
+		} else {
+			out.Ranges[i] = make([]int, len(in.Ranges[i]))
+			copy(out.Ranges[i], in.Ranges[i])
+		}
+	}
+	if in.Scores == nil {
+		out.Scores = nil
+	} else {
+		out.Scores = make(Scores, len(in.Scores))
+		for k, v := range in.Scores {
+			var c *int
+			if v == nil {
+				c = nil
+			} else {
+				c = new(int)
+				*c = *v
+			}
+			out.Scores[k] = c
+		}
+	}
+}
+
+// DeepCopy returns a new S4 sharing no memory with in.
+func (in *S4) DeepCopy() *S4 {
+	if in == nil {
+		return nil
+	}
+	out := new(S4)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,122 @@
+package structs
+
+import "sync"
+
+// S1 works, but only for map[int]int, and only with AddElement and Len. With type parameters,
+// the same "map + mutex" structure can be written once for every key and value type.
+//
+// Two differences with S1 :
+//   - the mutex is a sync.RWMutex : any number of Get can run at the same time, only writes
+//     are exclusive. It's worth it when reads are much more common than writes.
+//   - the mutex is a named, unexported field instead of an anonymous one. Callers can't Lock
+//     the map themselves, so every access goes through a method and nobody can forget to unlock.
+
+// Map is a map protected by a sync.RWMutex. The zero value is an empty map ready to use.
+// A Map must not be copied after first use (go vet will tell you).
+type Map[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+}
+
+func (s *Map[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.m)
+}
+
+func (s *Map[K, V]) Get(key K) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.m[key]
+	return v, ok
+}
+
+func (s *Map[K, V]) Set(key K, val V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.m[key] = val
+}
+
+func (s *Map[K, V]) Delete(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
+
+// LoadOrStore returns the existing value for key if there is one (loaded is true).
+// Otherwise it stores val and returns it.
+func (s *Map[K, V]) LoadOrStore(key K, val V) (actual V, loaded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.m[key]; ok {
+		return v, true
+	}
+	s.init()
+	s.m[key] = val
+	return val, false
+}
+
+// CompareAndSwap sets key to new only if its current value is old. Like sync.Map, it panics
+// if V isn't comparable (a slice, a map...) : use Update for those.
+func (s *Map[K, V]) CompareAndSwap(key K, old, new V) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.m[key]; !ok || any(v) != any(old) {
+		return false
+	}
+	s.m[key] = new
+	return true
+}
+
+// Update replaces the value of key with what fn returns, atomically : nothing can change key
+// between the read and the write. fn gets the current value, and ok is false if there is none.
+// If fn returns keep == false, key is deleted.
+//
+// fn runs with the lock held : it must be quick, and must not call methods of s.
+func (s *Map[K, V]) Update(key K, fn func(v V, ok bool) (newV V, keep bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[key]
+	v, keep := fn(v, ok)
+	if !keep {
+		delete(s.m, key)
+		return
+	}
+	s.init()
+	s.m[key] = v
+}
+
+// Range calls fn on every element, until fn returns false. It iterates over a copy taken at
+// the start, so fn sees a consistent snapshot and is free to modify s.
+func (s *Map[K, V]) Range(fn func(key K, val V) bool) {
+	for k, v := range s.Snapshot() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the content of s.
+func (s *Map[K, V]) Snapshot() map[K]V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := make(map[K]V, len(s.m))
+	for k, v := range s.m {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+func (s *Map[K, V]) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m = nil
+}
+
+// init must be called with the write lock held.
+func (s *Map[K, V]) init() {
+	if s.m == nil {
+		s.m = make(map[K]V)
+	}
+}
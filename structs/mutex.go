@@ -0,0 +1,314 @@
+package structs
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// When a program is slow because of a lock, sync.Mutex doesn't say anything : not how long
+// goroutines wait for it, not how long it's held, not who holds it. Mutex is a replacement
+// that keeps track of that. It's embedded the same way : in S1, replacing sync.Mutex by
+// structs.Mutex changes nothing else, s.Lock() and s.Unlock() still work.
+//
+// It also checks the order in which named mutexes are locked. If a goroutine locks A then B,
+// and another one locks B then A, each can end up holding one and waiting for the other
+// forever. This usually only happens under load, so it's reported as soon as both orders
+// have been seen, even if they didn't deadlock this time.
+//
+// Build with -tags mutexdebug to also record the stack of the goroutine holding the lock :
+// it's expensive, so it's off by default.
+
+// Mutex is a sync.Mutex with statistics. The zero value is an unlocked, unnamed mutex.
+// Like sync.Mutex, it must not be copied after first use.
+type Mutex struct {
+	mu sync.Mutex
+
+	// Set before first use, read-only after
+	name string
+
+	// Only accessed by the goroutine holding mu
+	lockedAt time.Time
+	goid     int64
+
+	statsMu sync.Mutex
+	stats   MutexStats
+	holder  []byte
+}
+
+// MutexStats are the measures of a Mutex since its creation.
+type MutexStats struct {
+	// Wait is the time spent in Lock before getting the mutex
+	Wait Histogram
+	// Hold is the time between Lock and Unlock
+	Hold Histogram
+}
+
+// SetName names m, enabling lock order checks. It must be called before m is used. Names must
+// be unique : two mutexes with the same name are seen as one.
+func (m *Mutex) SetName(name string) {
+	m.name = name
+}
+
+func (m *Mutex) Lock() {
+	var goid int64
+	if m.name != "" {
+		goid = currentGoid()
+		lockOrder.acquiring(goid, m.name)
+	}
+
+	start := time.Now()
+	m.mu.Lock()
+	m.acquired(goid, start)
+}
+
+// TryLock tries to lock m and reports whether it succeeded, like sync.Mutex.TryLock. It never
+// waits, so it can't deadlock : lock order isn't checked, but m counts as held for the locks
+// taken after it.
+func (m *Mutex) TryLock() bool {
+	start := time.Now()
+	if !m.mu.TryLock() {
+		return false
+	}
+	var goid int64
+	if m.name != "" {
+		goid = currentGoid()
+	}
+	m.acquired(goid, start)
+	return true
+}
+
+// acquired is called once m.mu is locked, by the goroutine goid, which started waiting at start.
+func (m *Mutex) acquired(goid int64, start time.Time) {
+	m.lockedAt = time.Now()
+	m.goid = goid
+
+	if m.name != "" {
+		lockOrder.acquired(goid, m.name)
+	}
+	m.statsMu.Lock()
+	m.stats.Wait.Observe(m.lockedAt.Sub(start))
+	m.holder = captureStack()
+	m.statsMu.Unlock()
+}
+
+func (m *Mutex) Unlock() {
+	held := time.Since(m.lockedAt)
+	if m.name != "" {
+		// Maybe not the goroutine running Unlock : a Mutex can be unlocked by another one
+		lockOrder.released(m.goid, m.name)
+	}
+	m.statsMu.Lock()
+	m.stats.Hold.Observe(held)
+	m.holder = nil
+	m.statsMu.Unlock()
+	m.mu.Unlock()
+}
+
+func (m *Mutex) Stats() MutexStats {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.stats
+}
+
+// Holder returns the stack of the goroutine holding m when it locked it. It's only recorded
+// when built with -tags mutexdebug, and is empty if m isn't locked.
+func (m *Mutex) Holder() string {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return string(m.holder)
+}
+
+const histogramBuckets = 22
+
+// Histogram counts durations in buckets growing by powers of 2 : below 1µs, below 2µs, below
+// 4µs... up to about 1s, and the last bucket for everything above.
+type Histogram struct {
+	Count   uint64
+	Total   time.Duration
+	Max     time.Duration
+	Buckets [histogramBuckets]uint64
+}
+
+// BucketBound returns the upper bound of bucket i. The last bucket has no upper bound.
+func BucketBound(i int) time.Duration {
+	return time.Microsecond << i
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < histogramBuckets-1 && d >= BucketBound(i) {
+		i++
+	}
+	h.Buckets[i]++
+	h.Count++
+	h.Total += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Total / time.Duration(h.Count)
+}
+
+// Percentile returns the upper bound of the bucket containing the p-th percentile (0 < p <= 100),
+// or Max if it is in the last bucket.
+func (h Histogram) Percentile(p float64) time.Duration {
+	target := uint64(float64(h.Count)*p/100 + 0.5)
+	var seen uint64
+	for i := 0; i < histogramBuckets-1; i++ {
+		seen += h.Buckets[i]
+		if seen >= target && seen > 0 {
+			return BucketBound(i)
+		}
+	}
+	return h.Max
+}
+
+// LockOrderError describes two named mutexes locked in both orders, or a named mutex locked
+// again by the goroutine holding it (Held and Acquired are then the same).
+type LockOrderError struct {
+	// Held was already locked when Acquired was locked, but elsewhere, Acquired was locked
+	// (maybe indirectly, through the other mutexes of Cycle) before Held.
+	Held, Acquired string
+	Cycle          []string
+	// Stack is the stack of the goroutine locking Acquired, only with -tags mutexdebug
+	Stack []byte
+}
+
+func (e *LockOrderError) Error() string {
+	if e.Held == e.Acquired {
+		return fmt.Sprintf("deadlock: %q locked again by the goroutine holding it", e.Acquired)
+	}
+	return fmt.Sprintf("potential deadlock: %q locked while holding %q, but also locked before it (%s)",
+		e.Acquired, e.Held, strings.Join(e.Cycle, " -> "))
+}
+
+// ReportLockOrder is called once for each pair of named mutexes locked in both orders, and once
+// for each named mutex locked again by the goroutine holding it.
+// It logs the error by default, tests can replace it before locking any Mutex.
+var ReportLockOrder = func(err *LockOrderError) {
+	log.Println(err)
+	if len(err.Stack) > 0 {
+		log.Printf("%s", err.Stack)
+	}
+}
+
+// lockOrder is the graph of every "A was held while locking B" seen so far.
+var lockOrder = lockGraph{
+	after:    make(map[string]map[string]bool),
+	held:     make(map[int64][]string),
+	reported: make(map[[2]string]bool),
+}
+
+type lockGraph struct {
+	mu       sync.Mutex
+	after    map[string]map[string]bool // after[a][b] : b was locked while holding a
+	held     map[int64][]string         // names held by each goroutine
+	reported map[[2]string]bool
+}
+
+// acquiring is called before locking name, so that a real deadlock is reported too.
+func (g *lockGraph) acquiring(goid int64, name string) {
+	var errs []*LockOrderError
+	g.mu.Lock()
+	for _, held := range g.held[goid] {
+		pair := [2]string{held, name}
+		if held == name {
+			// Not a potential deadlock, a certain one : sync.Mutex isn't reentrant
+			if !g.reported[pair] {
+				g.reported[pair] = true
+				errs = append(errs, &LockOrderError{Held: name, Acquired: name, Cycle: []string{name}, Stack: captureStack()})
+			}
+			continue
+		}
+		if g.after[held][name] {
+			continue
+		}
+		if g.after[name] == nil {
+			g.after[name] = make(map[string]bool)
+		}
+		if g.after[held] == nil {
+			g.after[held] = make(map[string]bool)
+		}
+		g.after[held][name] = true
+
+		if path := g.path(name, held); path != nil && !g.reported[pair] {
+			g.reported[pair] = true
+			errs = append(errs, &LockOrderError{Held: held, Acquired: name, Cycle: path, Stack: captureStack()})
+		}
+	}
+	g.mu.Unlock()
+
+	for _, err := range errs {
+		ReportLockOrder(err)
+	}
+}
+
+func (g *lockGraph) acquired(goid int64, name string) {
+	g.mu.Lock()
+	g.held[goid] = append(g.held[goid], name)
+	g.mu.Unlock()
+}
+
+func (g *lockGraph) released(goid int64, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	held := g.held[goid]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i] == name {
+			held = append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(held) == 0 {
+		delete(g.held, goid)
+	} else {
+		g.held[goid] = held
+	}
+}
+
+// path returns the names from "from" to "to" following the edges of the graph, or nil.
+// Must be called with g.mu held.
+func (g *lockGraph) path(from, to string) []string {
+	visited := make(map[string]bool)
+	var walk func(n string) []string
+	walk = func(n string) []string {
+		if n == to {
+			return []string{n}
+		}
+		visited[n] = true
+		for next := range g.after[n] {
+			if visited[next] {
+				continue
+			}
+			if p := walk(next); p != nil {
+				return append([]string{n}, p...)
+			}
+		}
+		return nil
+	}
+	return walk(from)
+}
+
+// currentGoid extracts the id of the current goroutine from its stack trace. Go doesn't give
+// it any other way, on purpose : it's only used for debugging here.
+func currentGoid() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,11 @@
+//go:build mutexdebug
+
+package structs
+
+import "runtime/debug"
+
+// captureStack returns the stack of the current goroutine, for Mutex.Holder and
+// LockOrderError.
+func captureStack() []byte {
+	return debug.Stack()
+}
@@ -0,0 +1,8 @@
+//go:build !mutexdebug
+
+package structs
+
+// captureStack only records something with -tags mutexdebug, see mutex_debug.go.
+func captureStack() []byte {
+	return nil
+}
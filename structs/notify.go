@@ -0,0 +1,191 @@
+package structs
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Other parts of a program often need to know when a shared map changes. Calling them from
+// inside AddElement would run their code with the lock held : a slow listener slows down every
+// user of the map, and a listener reading the map deadlocks.
+//
+// Instead, a change is only *recorded* while the lock is held (appending to a slice, cheap),
+// and delivered to subscribers after the lock is released. Events are recorded in the order
+// the changes happened, and delivered in that same order.
+//
+// Each subscriber reads from its own buffered channel. What happens when a subscriber is too
+// slow and its buffer is full is up to it :
+//   - Block : the writer waits until there is room. Nothing is lost, but writers go at the
+//     speed of the slowest subscriber (the map lock itself is free though : readers aren't
+//     affected).
+//   - DropOldest : the oldest event in the buffer is thrown away. Good for "latest state"
+//     listeners, like a UI.
+//   - DropNewest : the new event is thrown away.
+
+type EventKind int
+
+const (
+	Added EventKind = iota
+	Updated
+	Deleted
+)
+
+// Event describes one change of a key. Old is the zero value for Added, New for Deleted.
+type Event[K comparable, V any] struct {
+	Kind     EventKind
+	Key      K
+	Old, New V
+}
+
+type OverflowPolicy int
+
+const (
+	Block OverflowPolicy = iota
+	DropOldest
+	DropNewest
+)
+
+// SubscribeOptions configures a subscriber. The zero value is an unbuffered channel, blocking.
+// Dropping policies always get a buffer of at least 1.
+type SubscribeOptions struct {
+	Buffer   int
+	Overflow OverflowPolicy
+}
+
+// Notifier delivers events to subscribers. The zero value is ready to use.
+// It's meant to be embedded in a structure protected by a mutex, see S1.
+type Notifier[K comparable, V any] struct {
+	mu          sync.Mutex
+	subscribers []*subscriber[K, V] // replaced, never modified in place, once recorded
+	pending     []pendingEvent[K, V]
+
+	// Read without mu, so that Record and Deliver cost nothing when nobody listens
+	subscriberCount int32
+	pendingCount    int32
+
+	// Held while delivering, so that events are sent one batch at a time, in order
+	deliverMu sync.Mutex
+}
+
+// pendingEvent is an event and the subscribers when it happened : a subscriber that comes
+// later doesn't get it.
+type pendingEvent[K comparable, V any] struct {
+	event Event[K, V]
+	to    []*subscriber[K, V]
+}
+
+type subscriber[K comparable, V any] struct {
+	ch       chan Event[K, V]
+	overflow OverflowPolicy
+	done     chan struct{}
+}
+
+// Subscribe returns a channel receiving every change from now on, and a function to stop
+// receiving them. The channel is closed once unsubscribed.
+func (n *Notifier[K, V]) Subscribe(opts SubscribeOptions) (<-chan Event[K, V], func()) {
+	if opts.Overflow != Block && opts.Buffer < 1 {
+		opts.Buffer = 1
+	}
+	sub := &subscriber[K, V]{
+		ch:       make(chan Event[K, V], opts.Buffer),
+		overflow: opts.Overflow,
+		done:     make(chan struct{}),
+	}
+	n.mu.Lock()
+	// A new slice : pending events keep the list they were recorded with
+	n.subscribers = append(n.subscribers[:len(n.subscribers):len(n.subscribers)], sub)
+	atomic.AddInt32(&n.subscriberCount, 1)
+	n.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			// Unblocks a delivery waiting for this subscriber
+			close(sub.done)
+			n.mu.Lock()
+			for i, s := range n.subscribers {
+				if s == sub {
+					n.subscribers = append(n.subscribers[:i:i], n.subscribers[i+1:]...)
+					atomic.AddInt32(&n.subscriberCount, -1)
+					break
+				}
+			}
+			n.mu.Unlock()
+			// Wait for a delivery in progress to be done with sub.ch before closing it
+			n.deliverMu.Lock()
+			close(sub.ch)
+			n.deliverMu.Unlock()
+		})
+	}
+}
+
+// Record adds an event to be delivered by the next call to Deliver. It must be called with
+// the lock of the map held, so that events are recorded in the order of the changes.
+func (n *Notifier[K, V]) Record(e Event[K, V]) {
+	if atomic.LoadInt32(&n.subscriberCount) == 0 {
+		return
+	}
+	n.mu.Lock()
+	if len(n.subscribers) > 0 {
+		n.pending = append(n.pending, pendingEvent[K, V]{event: e, to: n.subscribers})
+		atomic.AddInt32(&n.pendingCount, 1)
+	}
+	n.mu.Unlock()
+}
+
+// Deliver sends the recorded events to the subscribers. It must be called without the lock of
+// the map held, after Record.
+func (n *Notifier[K, V]) Deliver() {
+	// Nothing recorded, or another goroutine already took our events along with its own
+	if atomic.LoadInt32(&n.pendingCount) == 0 {
+		return
+	}
+	n.deliverMu.Lock()
+	defer n.deliverMu.Unlock()
+
+	n.mu.Lock()
+	events := n.pending
+	n.pending = nil
+	atomic.StoreInt32(&n.pendingCount, 0)
+	n.mu.Unlock()
+
+	for _, pe := range events {
+		for _, sub := range pe.to {
+			sub.send(pe.event)
+		}
+	}
+}
+
+// send is only called with deliverMu held : nobody else is sending on s.ch at the same time.
+func (s *subscriber[K, V]) send(e Event[K, V]) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	switch s.overflow {
+	case DropNewest:
+		select {
+		case s.ch <- e:
+		default:
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.ch <- e:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- e:
+		case <-s.done:
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package structs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A Map lives in memory : when the process restarts, it's gone. Saving it to disk is easy,
+// saving it *safely* takes a bit more care :
+//   - the content must be consistent : Map.Snapshot copies it under the lock, and the (slow)
+//     encoding and writing happen on the copy, without blocking anyone.
+//   - a crash while writing must not destroy the previous file : the snapshot is written to a
+//     temporary file, synced, then renamed over the old one. A rename is atomic, so the file
+//     is always either the complete old snapshot or the complete new one.
+//   - a file damaged by something else (disk, manual edit...) must be detected : the first
+//     line of the file is a SHA-256 of the rest, checked before anything is restored.
+
+type SnapshotFormat int
+
+const (
+	// Gob works for any key and value types gob can encode.
+	Gob SnapshotFormat = iota
+	// JSON is readable by humans and other tools, but keys must be strings, integers or
+	// implement encoding.TextMarshaler.
+	JSON
+)
+
+var ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+
+const checksumPrefix = "sha256:"
+
+// SaveSnapshot writes the content of m to path.
+func SaveSnapshot[K comparable, V any](m *Map[K, V], path string, format SnapshotFormat) error {
+	var payload bytes.Buffer
+	if err := encodeSnapshot(&payload, m.Snapshot(), format); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload.Bytes())
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Only does something if we didn't get to the rename
+		_ = os.Remove(tmp.Name())
+	}()
+
+	w := bufio.NewWriter(tmp)
+	_, _ = fmt.Fprintf(w, "%s%s\n", checksumPrefix, hex.EncodeToString(sum[:]))
+	_, _ = w.Write(payload.Bytes())
+	err = w.Flush()
+	if err == nil {
+		// Make sure the data is on disk before the rename makes it visible
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// RestoreSnapshot replaces the content of m with the snapshot in path. If the file is invalid,
+// m isn't modified. A missing file returns an error matching fs.ErrNotExist, which is usually
+// fine on the first start.
+func RestoreSnapshot[K comparable, V any](m *Map[K, V], path string, format SnapshotFormat) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	header, payload, found := bytes.Cut(data, []byte("\n"))
+	if !found || !bytes.HasPrefix(header, []byte(checksumPrefix)) {
+		return fmt.Errorf("%s: %w: no checksum header", path, ErrSnapshotChecksum)
+	}
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != string(header[len(checksumPrefix):]) {
+		return fmt.Errorf("%s: %w", path, ErrSnapshotChecksum)
+	}
+
+	content := make(map[K]V)
+	switch format {
+	case Gob:
+		err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&content)
+	case JSON:
+		err = json.Unmarshal(payload, &content)
+	default:
+		err = fmt.Errorf("unknown snapshot format %d", format)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	m.mu.Lock()
+	m.m = content
+	m.mu.Unlock()
+	return nil
+}
+
+// SnapshotEvery saves m to path every interval, and one last time when ctx is done.
+// Errors are passed to onError, which can be nil.
+func SnapshotEvery[K comparable, V any](ctx context.Context, m *Map[K, V], path string, format SnapshotFormat, interval time.Duration, onError func(error)) {
+	save := func() {
+		if err := SaveSnapshot(m, path, format); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
+
+func encodeSnapshot[K comparable, V any](w io.Writer, content map[K]V, format SnapshotFormat) error {
+	switch format {
+	case Gob:
+		return gob.NewEncoder(w).Encode(content)
+	case JSON:
+		return json.NewEncoder(w).Encode(content)
+	}
+	return fmt.Errorf("unknown snapshot format %d", format)
+}
@@ -0,0 +1,138 @@
+package structs
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// TestStructsS1Mutex has 1000 goroutines fighting for the same sync.Mutex : only one of them
+// can work at a time, whatever the number of CPUs. Sharding splits the map into several
+// smaller maps, each with its own lock, and the key decides which shard it belongs to.
+// Two goroutines only wait for each other when their keys land in the same shard.
+//
+// The cost : anything that needs the whole map (Len, Range) has to visit every shard.
+
+// ShardedMap is a map split into shards, each protected by its own sync.RWMutex.
+// Use NewShardedMap to create one.
+type ShardedMap[K comparable, V any] struct {
+	shards []shard[K, V]
+	hash   func(K) uint64
+}
+
+type shard[K comparable, V any] struct {
+	sync.RWMutex
+	m map[K]V
+
+	// Pad shards to about a cache line (64 bytes), so that locking one doesn't slow down its
+	// neighbours in the slice
+	_ [32]byte
+}
+
+// NewShardedMap returns a map with the given number of shards (at least 1). hash chooses the
+// shard of a key : it should spread keys evenly. There are ready-made ones below.
+func NewShardedMap[K comparable, V any](shards int, hash func(K) uint64) *ShardedMap[K, V] {
+	if shards < 1 {
+		shards = 1
+	}
+	s := &ShardedMap[K, V]{shards: make([]shard[K, V], shards), hash: hash}
+	for i := range s.shards {
+		s.shards[i].m = make(map[K]V)
+	}
+	return s
+}
+
+var seed = maphash.MakeSeed()
+
+// StringHash is a hash for string keys.
+func StringHash(key string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(seed)
+	_, _ = h.WriteString(key)
+	return h.Sum64()
+}
+
+// IntHash is a hash for int keys. Consecutive ints are common keys (IDs...), so they are mixed
+// instead of taken modulo the number of shards directly.
+func IntHash(key int) uint64 {
+	// splitmix64 finalizer
+	x := uint64(key)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (s *ShardedMap[K, V]) shardFor(key K) *shard[K, V] {
+	return &s.shards[s.hash(key)%uint64(len(s.shards))]
+}
+
+func (s *ShardedMap[K, V]) Get(key K) (V, bool) {
+	sh := s.shardFor(key)
+	sh.RLock()
+	defer sh.RUnlock()
+	v, ok := sh.m[key]
+	return v, ok
+}
+
+func (s *ShardedMap[K, V]) Set(key K, val V) {
+	sh := s.shardFor(key)
+	sh.Lock()
+	sh.m[key] = val
+	sh.Unlock()
+}
+
+func (s *ShardedMap[K, V]) Delete(key K) {
+	sh := s.shardFor(key)
+	sh.Lock()
+	delete(sh.m, key)
+	sh.Unlock()
+}
+
+// Update works like Map.Update, and only locks the shard of key.
+func (s *ShardedMap[K, V]) Update(key K, fn func(v V, ok bool) (newV V, keep bool)) {
+	sh := s.shardFor(key)
+	sh.Lock()
+	defer sh.Unlock()
+	v, ok := sh.m[key]
+	if v, keep := fn(v, ok); keep {
+		sh.m[key] = v
+	} else {
+		delete(sh.m, key)
+	}
+}
+
+// Len adds up the length of every shard. Since shards are locked one after the other, the
+// result can be off if other goroutines are writing at the same time.
+func (s *ShardedMap[K, V]) Len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.RLock()
+		n += len(sh.m)
+		sh.RUnlock()
+	}
+	return n
+}
+
+// Range calls fn on every element until fn returns false. Each shard is copied before fn is
+// called on its elements, so fn can modify s ; but like Len, the shards aren't all copied at
+// the same time.
+func (s *ShardedMap[K, V]) Range(fn func(key K, val V) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.RLock()
+		snapshot := make(map[K]V, len(sh.m))
+		for k, v := range sh.m {
+			snapshot[k] = v
+		}
+		sh.RUnlock()
+
+		for k, v := range snapshot {
+			if !fn(k, v) {
+				return
+			}
+		}
+	}
+}
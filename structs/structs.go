@@ -14,6 +14,8 @@ type S1 struct {
 	sync.Mutex
 
 	protectedMap map[int]int
+	changes      Notifier[int, int]
+	version      uint64 // incremented by every write, see UpdateOptimistic
 }
 
 func (s *S1) Len() int {
@@ -24,11 +26,51 @@ func (s *S1) Len() int {
 
 func (s *S1) AddElement(key, val int) {
 	s.Lock()
+	s.set(key, val)
+	s.Unlock()
+	s.changes.Deliver()
+}
+
+func (s *S1) DeleteElement(key int) {
+	s.Lock()
+	s.delete(key)
+	s.Unlock()
+	s.changes.Deliver()
+}
+
+// set and delete must be called with the lock held, and changes.Deliver after unlocking.
+func (s *S1) set(key, val int) {
 	if s.protectedMap == nil {
 		s.protectedMap = make(map[int]int)
 	}
+	old, ok := s.protectedMap[key]
 	s.protectedMap[key] = val
-	s.Unlock()
+	s.version++
+	if !ok {
+		s.changes.Record(Event[int, int]{Kind: Added, Key: key, New: val})
+	} else if old != val {
+		s.changes.Record(Event[int, int]{Kind: Updated, Key: key, Old: old, New: val})
+	}
+}
+
+func (s *S1) delete(key int) {
+	if old, ok := s.protectedMap[key]; ok {
+		delete(s.protectedMap, key)
+		s.version++
+		s.changes.Record(Event[int, int]{Kind: Deleted, Key: key, Old: old})
+	}
+}
+
+// Subscribe returns a channel receiving every change of the map. See Notifier.
+func (s *S1) Subscribe(opts SubscribeOptions) (<-chan Event[int, int], func()) {
+	return s.changes.Subscribe(opts)
+}
+
+func (s *S1) GetElement(key int) (int, bool) {
+	s.Lock()
+	defer s.Unlock()
+	val, ok := s.protectedMap[key]
+	return val, ok
 }
 
 // Random useful stuff
@@ -38,6 +80,7 @@ func (_ *S1) DoSomething() {
 	// this function doesn't actually do anything with the structure itself.
 }
 
+//deepcopy:generate
 type S2 struct {
 	attr string
 }
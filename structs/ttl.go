@@ -0,0 +1,166 @@
+package structs
+
+import (
+	"sync"
+	"time"
+)
+
+// A map used as a cache needs its entries to go away after a while. Each entry stores its
+// expiration date, and there are two ways of removing expired ones :
+//   - lazily : Get notices the entry expired, deletes it and says it's not there. Free, but an
+//     entry nobody asks for stays in memory forever.
+//   - in the background : a goroutine regularly sweeps the whole map.
+//
+// Both are used here. Time comes from a function that tests can replace, so they don't have
+// to sleep to see an entry expire.
+
+// TTLOptions configures a TTLMap.
+type TTLOptions[K comparable, V any] struct {
+	// DefaultTTL is used by Set. Zero or negative means entries never expire.
+	DefaultTTL time.Duration
+	// OnEvict is called, without any lock held, for every entry removed because it expired.
+	OnEvict func(key K, val V)
+	// Now is time.Now if nil.
+	Now func() time.Time
+}
+
+// TTLMap is a concurrent map whose entries expire. Use NewTTLMap to create one.
+type TTLMap[K comparable, V any] struct {
+	mu sync.Mutex
+
+	m    map[K]ttlEntry[V]
+	opts TTLOptions[K, V]
+	stop chan struct{}
+}
+
+type ttlEntry[V any] struct {
+	val       V
+	expiresAt time.Time // zero : never
+}
+
+func NewTTLMap[K comparable, V any](opts TTLOptions[K, V]) *TTLMap[K, V] {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &TTLMap[K, V]{m: make(map[K]ttlEntry[V]), opts: opts}
+}
+
+// Set stores val for the default TTL.
+func (s *TTLMap[K, V]) Set(key K, val V) {
+	s.SetWithTTL(key, val, s.opts.DefaultTTL)
+}
+
+// SetWithTTL stores val for ttl. Zero or negative means it never expires.
+func (s *TTLMap[K, V]) SetWithTTL(key K, val V, ttl time.Duration) {
+	e := ttlEntry[V]{val: val}
+	if ttl > 0 {
+		e.expiresAt = s.opts.Now().Add(ttl)
+	}
+	s.mu.Lock()
+	s.m[key] = e
+	s.mu.Unlock()
+}
+
+// Get returns the value of key, unless it expired.
+func (s *TTLMap[K, V]) Get(key K) (V, bool) {
+	now := s.opts.Now()
+	s.mu.Lock()
+	e, ok := s.m[key]
+	if ok && e.expired(now) {
+		delete(s.m, key)
+		s.mu.Unlock()
+		s.evicted(map[K]V{key: e.val})
+		var zero V
+		return zero, false
+	}
+	s.mu.Unlock()
+	return e.val, ok
+}
+
+// Delete removes key. OnEvict isn't called : the entry didn't expire.
+func (s *TTLMap[K, V]) Delete(key K) {
+	s.mu.Lock()
+	delete(s.m, key)
+	s.mu.Unlock()
+}
+
+// Len returns the number of entries that didn't expire yet.
+func (s *TTLMap[K, V]) Len() int {
+	now := s.opts.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, e := range s.m {
+		if !e.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// DeleteExpired removes every expired entry, and returns how many there were.
+func (s *TTLMap[K, V]) DeleteExpired() int {
+	now := s.opts.Now()
+	expired := make(map[K]V)
+	s.mu.Lock()
+	for k, e := range s.m {
+		if e.expired(now) {
+			expired[k] = e.val
+			delete(s.m, k)
+		}
+	}
+	s.mu.Unlock()
+
+	s.evicted(expired)
+	return len(expired)
+}
+
+// StartJanitor calls DeleteExpired every interval in a new goroutine, until Stop is called.
+// Calling it again replaces the previous janitor.
+func (s *TTLMap[K, V]) StartJanitor(interval time.Duration) {
+	stop := make(chan struct{})
+	// Stopping the previous janitor and installing the new one in one step : two concurrent
+	// calls can't both start a janitor that nobody stops
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+	}
+	s.stop = stop
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.DeleteExpired()
+			}
+		}
+	}()
+}
+
+// Stop stops the janitor, if there is one.
+func (s *TTLMap[K, V]) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *TTLMap[K, V]) evicted(entries map[K]V) {
+	if s.opts.OnEvict == nil {
+		return
+	}
+	for k, v := range entries {
+		s.opts.OnEvict(k, v)
+	}
+}
+
+func (e ttlEntry[V]) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
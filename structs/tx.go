@@ -0,0 +1,125 @@
+package structs
+
+import "errors"
+
+// Moving a value from one key to another with two AddElement calls isn't safe : between the
+// two calls, another goroutine can read the map with the value in both keys (or in none), or
+// change one of them. Every read and write of the move has to happen under the same Lock.
+//
+// Update does that : fn gets a transaction, and everything it reads or writes through it is
+// applied at once, or not at all if fn returns an error. Writes are buffered in the
+// transaction, so a rollback is only forgetting the buffer.
+//
+// Holding the lock during the whole of fn blocks every other user of the map. When fn is slow
+// and conflicts are rare, UpdateOptimistic runs fn without the lock, and only takes it to
+// commit : if the map changed in the meantime, fn's reads may be stale, so it runs again.
+
+var ErrTxConflict = errors.New("transaction conflict: too many retries")
+
+// Tx is the view of an S1 inside Update and UpdateOptimistic. It must not be used after fn
+// returns.
+type Tx struct {
+	s      *S1
+	locked bool
+
+	writes map[int]txWrite
+	order  []int // keys of writes, in the order of the first write
+}
+
+type txWrite struct {
+	val     int
+	deleted bool
+}
+
+// Get returns the value of key, including the writes made earlier in the transaction.
+func (tx *Tx) Get(key int) (int, bool) {
+	if w, ok := tx.writes[key]; ok {
+		return w.val, !w.deleted
+	}
+	if !tx.locked {
+		tx.s.Lock()
+		defer tx.s.Unlock()
+	}
+	val, ok := tx.s.protectedMap[key]
+	return val, ok
+}
+
+func (tx *Tx) Set(key, val int) {
+	tx.write(key, txWrite{val: val})
+}
+
+func (tx *Tx) Delete(key int) {
+	tx.write(key, txWrite{deleted: true})
+}
+
+func (tx *Tx) write(key int, w txWrite) {
+	if tx.writes == nil {
+		tx.writes = make(map[int]txWrite)
+	}
+	if _, ok := tx.writes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = w
+}
+
+// commit applies the writes. Must be called with the lock held.
+func (tx *Tx) commit() {
+	for _, key := range tx.order {
+		if w := tx.writes[key]; w.deleted {
+			tx.s.delete(key)
+		} else {
+			tx.s.set(key, w.val)
+		}
+	}
+}
+
+// Update runs fn with the lock held, and applies its writes if it returns nil. Otherwise
+// nothing is changed, and the error is returned.
+//
+// Like Map.Update, fn must be quick and must not call methods of s.
+func (s *S1) Update(fn func(tx *Tx) error) error {
+	// Deferred first so it runs last, once unlocked
+	defer s.changes.Deliver()
+	s.Lock()
+	defer s.Unlock()
+	tx := &Tx{s: s, locked: true}
+	err := fn(tx)
+	if err == nil {
+		tx.commit()
+	}
+	return err
+}
+
+// UpdateOptimistic runs fn without holding the lock, and applies its writes only if nothing
+// was written to s since fn started (an error from fn is returned under the same condition).
+// Otherwise fn runs again, up to retries more times, after which ErrTxConflict is returned.
+// fn can run several times : it must not have side effects.
+//
+// Any write to s counts as a conflict, even on keys fn didn't read : it's only worth it when
+// writes are rare.
+func (s *S1) UpdateOptimistic(retries int, fn func(tx *Tx) error) error {
+	for i := 0; i <= retries; i++ {
+		s.Lock()
+		version := s.version
+		s.Unlock()
+
+		tx := &Tx{s: s}
+		err := fn(tx)
+
+		s.Lock()
+		if s.version != version {
+			// Even an error may come from stale reads
+			s.Unlock()
+			continue
+		}
+		if err != nil {
+			s.Unlock()
+			return err
+		}
+		tx.commit()
+		s.Unlock()
+		s.changes.Deliver()
+		return nil
+	}
+	return ErrTxConflict
+}